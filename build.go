@@ -0,0 +1,122 @@
+package protolock
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// BuildOptions configures how BuildLock finds and parses proto files.
+type BuildOptions struct {
+	// Ignore is a comma-separated list of paths to skip, relative to the root
+	// of the file system.
+	Ignore string
+	// DisplayRoot is prepended to file paths reported by the parser, e.g. in
+	// syntax errors, so they can be found from the caller's working
+	// directory. It does not affect the paths stored in the Protolock.
+	DisplayRoot string
+}
+
+// BuildLock finds all .proto files recursively in fsys, parses each file and
+// accumulates all definitions into a Protolock. It enables a Protolock to be
+// built from any file system, such as an in-memory tree, a tarball or a git
+// tree object, rather than only from disk.
+func BuildLock(fsys fs.FS, opts BuildOptions) (*Protolock, error) {
+	return BuildLockContext(context.Background(), fsys, opts)
+}
+
+// BuildLockContext is like BuildLock, but stops parsing proto files and
+// returns the context's error if ctx is done.
+func BuildLockContext(
+	ctx context.Context,
+	fsys fs.FS,
+	opts BuildOptions,
+) (*Protolock, error) {
+	protoFiles, err := getProtoFilesFS(fsys, opts.Ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	// add all the definitions from the updated set of protos to a Protolock
+	// used for analysis and comparison against the current Protolock, saved
+	// as the proto.lock file in the current directory
+	updated := Protolock{Version: LockVersion}
+	for _, name := range protoFiles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		// Have the parser report the file path
+		friendlyPath := filepath.FromSlash(name)
+		if opts.DisplayRoot != "" {
+			friendlyPath = filepath.Join(opts.DisplayRoot, friendlyPath)
+		}
+		entry, err := Parse(friendlyPath, f)
+		if err != nil {
+			printIfErr(f.Close())
+			return nil, err
+		}
+
+		updated.Definitions = append(updated.Definitions, Definition{
+			Filepath: ProtoPath(Protopath(filepath.FromSlash(name))),
+			Def:      entry,
+		})
+
+		// manually close the file to prevent `too many open files` error
+		printIfErr(f.Close())
+	}
+
+	return &updated, nil
+}
+
+// getProtoFilesFS finds recursively all .proto files in fsys to be processed,
+// returning their slash-separated paths within fsys.
+func getProtoFilesFS(fsys fs.FS, ignores string) ([]string, error) {
+	var ignorePaths []string
+	if ignores != "" {
+		for _, ignore := range strings.Split(ignores, ",") {
+			ignorePaths = append(ignorePaths, path.Clean(filepath.ToSlash(ignore)))
+		}
+	}
+
+	protoFiles := []string{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// if not a .proto file, do not attempt to parse.
+		if !strings.HasSuffix(d.Name(), protoSuffix) {
+			return nil
+		}
+
+		// skip to next if is a directory
+		if d.IsDir() {
+			return nil
+		}
+
+		// skip if path is within an ignored path
+		for _, ignore := range ignorePaths {
+			if ignore == "." || name == ignore ||
+				strings.HasPrefix(name, ignore+"/") {
+				return nil
+			}
+		}
+
+		protoFiles = append(protoFiles, name)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return protoFiles, nil
+}
@@ -0,0 +1,42 @@
+package protolock
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildLock(t *testing.T) {
+	fsys := fstest.MapFS{
+		"simple.proto":             {Data: []byte(simpleProto)},
+		"nested/reserved.proto":    {Data: []byte(noUsingReservedFieldsProto)},
+		"exclude/excluded.proto":   {Data: []byte(simpleProto)},
+		"nested/not-a-proto.txt":   {Data: []byte("not a proto")},
+		"directory.proto/ok.proto": {Data: []byte(simpleProto)},
+	}
+
+	lock, err := BuildLock(fsys, BuildOptions{Ignore: "exclude"})
+	require.NoError(t, err)
+
+	var paths []Protopath
+	for _, def := range lock.Definitions {
+		paths = append(paths, def.Filepath)
+	}
+	assert.Equal(t, []Protopath{
+		"directory.proto:/:ok.proto",
+		"nested:/:reserved.proto",
+		"simple.proto",
+	}, paths)
+
+	fsys["nested/invalid.proto"] = &fstest.MapFile{Data: []byte("message {")}
+	_, err = BuildLock(fsys, BuildOptions{DisplayRoot: "protos"})
+	assert.ErrorContains(t, err, "invalid.proto")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = BuildLockContext(ctx, fsys, BuildOptions{})
+	assert.Equal(t, context.Canceled, err)
+}
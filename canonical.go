@@ -0,0 +1,192 @@
+package protolock
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Canonical returns a copy of the Protolock in canonical order, so that its
+// encoding does not depend on the order in which proto files were found or
+// their definitions declared. Definitions are ordered by path; messages,
+// enums, services, RPCs, imports and options by name; fields and maps by ID;
+// and reserved IDs and names in ascending order. Enum values keep their
+// declared order, which is significant: the first value of an enum is its
+// default in proto2, and the first of its aliases names a value in JSON.
+func (p *Protolock) Canonical() Protolock {
+	lock := Protolock{Version: p.Version}
+	for _, def := range p.Definitions {
+		lock.Definitions = append(lock.Definitions, Definition{
+			Filepath: def.Filepath,
+			Def:      canonicalEntry(def.Def),
+		})
+	}
+	sort.SliceStable(lock.Definitions, func(i, j int) bool {
+		return lock.Definitions[i].Filepath < lock.Definitions[j].Filepath
+	})
+
+	return lock
+}
+
+// WriteLock writes the canonical JSON encoding of the Protolock to w, as saved
+// in a proto.lock file: the Protolock in canonical order, indented by two
+// spaces, without HTML escaping, and ending in a newline.
+func WriteLock(w io.Writer, lock Protolock) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lock.Canonical())
+}
+
+// MarshalLock returns the canonical JSON encoding of the Protolock, see
+// WriteLock.
+func MarshalLock(lock Protolock) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := WriteLock(buf, lock); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func canonicalEntry(e Entry) Entry {
+	entry := Entry{
+		Syntax:  e.Syntax,
+		Package: e.Package,
+		Options: canonicalOptions(e.Options),
+	}
+
+	for _, msg := range e.Messages {
+		entry.Messages = append(entry.Messages, canonicalMessage(msg))
+	}
+	sort.SliceStable(entry.Messages, func(i, j int) bool {
+		return entry.Messages[i].Name < entry.Messages[j].Name
+	})
+
+	for _, enum := range e.Enums {
+		entry.Enums = append(entry.Enums, canonicalEnum(enum))
+	}
+	sort.SliceStable(entry.Enums, func(i, j int) bool {
+		return entry.Enums[i].Name < entry.Enums[j].Name
+	})
+
+	for _, svc := range e.Services {
+		entry.Services = append(entry.Services, canonicalService(svc))
+	}
+	sort.SliceStable(entry.Services, func(i, j int) bool {
+		return entry.Services[i].Name < entry.Services[j].Name
+	})
+
+	entry.Imports = append([]Import(nil), e.Imports...)
+	sort.SliceStable(entry.Imports, func(i, j int) bool {
+		return entry.Imports[i].Path < entry.Imports[j].Path
+	})
+
+	return entry
+}
+
+func canonicalMessage(m Message) Message {
+	msg := Message{
+		Name:          m.Name,
+		ReservedIDs:   append([]int(nil), m.ReservedIDs...),
+		ReservedNames: append([]string(nil), m.ReservedNames...),
+		Filepath:      m.Filepath,
+		Options:       canonicalOptions(m.Options),
+	}
+	sort.Ints(msg.ReservedIDs)
+	sort.Strings(msg.ReservedNames)
+
+	for _, f := range m.Fields {
+		msg.Fields = append(msg.Fields, canonicalField(f))
+	}
+	sort.SliceStable(msg.Fields, func(i, j int) bool {
+		return fieldLess(msg.Fields[i], msg.Fields[j])
+	})
+
+	for _, mp := range m.Maps {
+		msg.Maps = append(msg.Maps, Map{
+			KeyType: mp.KeyType,
+			Field:   canonicalField(mp.Field),
+		})
+	}
+	sort.SliceStable(msg.Maps, func(i, j int) bool {
+		return fieldLess(msg.Maps[i].Field, msg.Maps[j].Field)
+	})
+
+	for _, nested := range m.Messages {
+		msg.Messages = append(msg.Messages, canonicalMessage(nested))
+	}
+	sort.SliceStable(msg.Messages, func(i, j int) bool {
+		return msg.Messages[i].Name < msg.Messages[j].Name
+	})
+
+	return msg
+}
+
+func fieldLess(a, b Field) bool {
+	if a.ID != b.ID {
+		return a.ID < b.ID
+	}
+	return a.Name < b.Name
+}
+
+func canonicalField(f Field) Field {
+	f.Options = canonicalOptions(f.Options)
+	return f
+}
+
+func canonicalEnum(e Enum) Enum {
+	enum := Enum{
+		Name:          e.Name,
+		ReservedIDs:   append([]int(nil), e.ReservedIDs...),
+		ReservedNames: append([]string(nil), e.ReservedNames...),
+		AllowAlias:    e.AllowAlias,
+		Options:       canonicalOptions(e.Options),
+	}
+	sort.Ints(enum.ReservedIDs)
+	sort.Strings(enum.ReservedNames)
+
+	// enum values keep their declared order
+	for _, f := range e.EnumFields {
+		f.Options = canonicalOptions(f.Options)
+		enum.EnumFields = append(enum.EnumFields, f)
+	}
+
+	return enum
+}
+
+func canonicalService(s Service) Service {
+	svc := Service{
+		Name:     s.Name,
+		Filepath: s.Filepath,
+	}
+
+	for _, rpc := range s.RPCs {
+		rpc.Options = canonicalOptions(rpc.Options)
+		svc.RPCs = append(svc.RPCs, rpc)
+	}
+	sort.SliceStable(svc.RPCs, func(i, j int) bool {
+		return svc.RPCs[i].Name < svc.RPCs[j].Name
+	})
+
+	return svc
+}
+
+// canonicalOptions orders options by name. Repeated options with the same name
+// keep their declared order.
+func canonicalOptions(opts []Option) []Option {
+	if opts == nil {
+		return nil
+	}
+
+	options := make([]Option, 0, len(opts))
+	for _, o := range opts {
+		o.Aggregated = canonicalOptions(o.Aggregated)
+		options = append(options, o)
+	}
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Name < options[j].Name
+	})
+
+	return options
+}
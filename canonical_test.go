@@ -0,0 +1,126 @@
+package protolock
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const canonicalProtoA = `syntax = "proto3";
+package test;
+
+import "b.proto";
+import "a.proto";
+
+message Zeta {
+  option (b_opt) = "<b>";
+  option (a_opt) = "a";
+  reserved 9, 3;
+  reserved "z", "a";
+  string second = 2;
+  map<string, int32> later = 5;
+  map<string, int32> earlier = 4;
+  string first = 1;
+}
+
+message Alpha {
+  message Nested2 {}
+  message Nested1 {}
+}
+
+enum Status {
+  option allow_alias = true;
+  STARTED = 1;
+  UNKNOWN = 0;
+  RUNNING = 1;
+}
+
+service Svc {
+  rpc B (Alpha) returns (Zeta);
+  rpc A (Alpha) returns (Zeta);
+}
+`
+
+const canonicalProtoB = `syntax = "proto3";
+package test;
+
+import "a.proto";
+import "b.proto";
+
+service Svc {
+  rpc A (Alpha) returns (Zeta);
+  rpc B (Alpha) returns (Zeta);
+}
+
+enum Status {
+  option allow_alias = true;
+  STARTED = 1;
+  UNKNOWN = 0;
+  RUNNING = 1;
+}
+
+message Alpha {
+  message Nested1 {}
+  message Nested2 {}
+}
+
+message Zeta {
+  string first = 1;
+  option (a_opt) = "a";
+  string second = 2;
+  map<string, int32> earlier = 4;
+  map<string, int32> later = 5;
+  reserved 3, 9;
+  reserved "a", "z";
+  option (b_opt) = "<b>";
+}
+`
+
+func TestCanonical(t *testing.T) {
+	a := parseTestProto(t, canonicalProtoA)
+	b := parseTestProto(t, canonicalProtoB)
+	other := parseTestProto(t, simpleProto)
+	other.Definitions[0].Filepath = "a.proto"
+	a.Definitions = append(a.Definitions, other.Definitions...)
+	b.Definitions = append(other.Definitions, b.Definitions...)
+
+	assert.True(t, a.Equal(&b))
+
+	aJSON, err := MarshalLock(a)
+	require.NoError(t, err)
+	bJSON, err := MarshalLock(b)
+	require.NoError(t, err)
+	assert.Equal(t, string(aJSON), string(bJSON))
+	assert.True(t, bytes.HasSuffix(aJSON, []byte("}\n")))
+	assert.Contains(t, string(aJSON), `"<b>"`)
+
+	canonical := a.Canonical()
+	assert.True(t, canonical.Equal(&a))
+	assert.Equal(t, Protopath("a.proto"), canonical.Definitions[0].Filepath)
+
+	entry := canonical.Definitions[1].Def
+	assert.Equal(t, "a.proto", entry.Imports[0].Path)
+	assert.Equal(t, "Alpha", entry.Messages[0].Name)
+	assert.Equal(t, "Nested1", entry.Messages[0].Messages[0].Name)
+
+	zeta := entry.Messages[1]
+	assert.Equal(t, "first", zeta.Fields[0].Name)
+	assert.Equal(t, "earlier", zeta.Maps[0].Field.Name)
+	assert.Equal(t, []int{3, 9}, zeta.ReservedIDs)
+	assert.Equal(t, []string{"a", "z"}, zeta.ReservedNames)
+	assert.Equal(t, "(a_opt)", zeta.Options[0].Name)
+	assert.Equal(t, "A", entry.Services[0].RPCs[0].Name)
+
+	// enum values keep their declared order
+	var values []string
+	for _, v := range entry.Enums[0].EnumFields {
+		values = append(values, v.Name)
+	}
+	assert.Equal(t, []string{"STARTED", "UNKNOWN", "RUNNING"}, values)
+
+	// the original Protolock is not reordered
+	assert.Equal(t, "Zeta", a.Definitions[0].Def.Messages[0].Name)
+	assert.Equal(t, 9, a.Definitions[0].Def.Messages[0].ReservedIDs[0])
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nilslice/protolock"
+)
+
+// projectConfigName is the name of the optional project config file, read
+// from the lock directory unless a path is given using --config.
+const projectConfigName = ".protolock.json"
+
+// projectConfig contains settings for a project which are too detailed to be
+// expressed as command line flags.
+type projectConfig struct {
+	// Plugins maps a plugin name (as provided to --plugins) to its settings.
+	Plugins map[string]pluginConfig `json:"plugins,omitempty"`
+	// PluginDir is the directory WASM plugins are discovered in, relative to
+	// the lock directory. It defaults to ".protolock/plugins".
+	PluginDir string `json:"plugin_dir,omitempty"`
+	// Rules declares custom rules which are enforced in addition to the
+	// built-in rules.
+	Rules []protolock.RuleDefinition `json:"rules,omitempty"`
+	// LockLayout selects whether the lock is stored in a single proto.lock
+	// file ("single", the default), or sharded by "directory" or "package".
+	LockLayout string `json:"lock_layout,omitempty"`
+	// SensitiveOptions lists the option names which must not change, in
+	// place of the defaults. It is overridden by the --sensitiveoptions flag.
+	SensitiveOptions []string `json:"sensitive_options,omitempty"`
+}
+
+// pluginConfig contains the settings for a single plugin.
+type pluginConfig struct {
+	// Timeout limits how long the plugin may run before it is killed and
+	// reported as an error. It overrides the --plugintimeout flag.
+	Timeout duration `json:"timeout,omitempty"`
+
+	// The following settings only apply to WASM plugins, and are passed to
+	// the plugin's Extism manifest.
+
+	// AllowedPaths maps host paths to the guest paths at which they are made
+	// available to the plugin.
+	AllowedPaths map[string]string `json:"allowed_paths,omitempty"`
+	// AllowedHosts lists the hosts the plugin may make HTTP requests to.
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+	// Config contains key/value pairs the plugin can read using the PDK.
+	Config map[string]string `json:"config,omitempty"`
+	// MemoryMaxPages limits the plugin's memory, in 64KiB pages.
+	MemoryMaxPages uint32 `json:"memory_max_pages,omitempty"`
+	// Wasi enables WASI for the plugin, and defaults to true.
+	Wasi *bool `json:"wasi,omitempty"`
+}
+
+// wasiEnabled reports whether WASI should be enabled for the plugin.
+func (pc pluginConfig) wasiEnabled() bool {
+	return pc.Wasi == nil || *pc.Wasi
+}
+
+// duration is a time.Duration which is encoded in JSON as a string, such as
+// "30s" or "2m".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// loadProjectConfig reads the project config from path, or from the lock
+// directory if path is empty. A missing config file in the lock directory is
+// not an error, and results in an empty config.
+func loadProjectConfig(path, lockDir string) (*projectConfig, error) {
+	explicit := path != ""
+	if !explicit {
+		path = filepath.Join(lockDir, projectConfigName)
+	}
+
+	cfg := &projectConfig{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// plugin returns the settings for the named plugin, using defaultTimeout if
+// the plugin has no timeout configured.
+func (cfg *projectConfig) plugin(name string, defaultTimeout time.Duration) pluginConfig {
+	pc := cfg.Plugins[name]
+	if pc.Timeout.Duration == 0 {
+		pc.Timeout.Duration = defaultTimeout
+	}
+	return pc
+}
+
+// sensitiveOptions returns the option names listed by the comma-separated
+// flag, or else those listed by the config.
+func (cfg *projectConfig) sensitiveOptions(flag string) []string {
+	if flag == "" {
+		return cfg.SensitiveOptions
+	}
+	return strings.Split(flag, ",")
+}
+
+// registerRules compiles the rules declared in the config, and registers them
+// with the engine.
+func (cfg *projectConfig) registerRules(engine *protolock.Engine) error {
+	for _, def := range cfg.Rules {
+		rule, err := def.Rule()
+		if err != nil {
+			return err
+		}
+
+		err = engine.RegisterRule(rule)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nilslice/protolock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectConfigSensitiveOptions(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(
+		filepath.Join(dir, projectConfigName),
+		[]byte(`{"sensitive_options": ["json_name", "(my.option)"]}`),
+		0644,
+	)
+	require.NoError(t, err)
+
+	cfg, err := loadProjectConfig("", dir)
+	require.NoError(t, err)
+
+	// the config replaces the defaults, unless the flag is set
+	assert.Equal(t, []string{"json_name", "(my.option)"}, cfg.sensitiveOptions(""))
+	assert.Equal(t, []string{"packed", " ctype"}, cfg.sensitiveOptions("packed, ctype"))
+
+	empty := &projectConfig{}
+	assert.Nil(t, empty.sensitiveOptions(""))
+}
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want time.Duration
+		err  bool
+	}{
+		{json: `"30s"`, want: 30 * time.Second},
+		{json: `"1m30s"`, want: 90 * time.Second},
+		{json: `"0s"`, want: 0},
+		{json: `"30"`, err: true},
+		{json: `"soon"`, err: true},
+		{json: `""`, err: true},
+		{json: `30`, err: true},
+		{json: `null`, err: true},
+	}
+
+	for _, tt := range tests {
+		var d duration
+		err := json.Unmarshal([]byte(tt.json), &d)
+		if tt.err {
+			assert.Error(t, err, tt.json)
+			continue
+		}
+		assert.NoError(t, err, tt.json)
+		assert.Equal(t, tt.want, d.Duration, tt.json)
+	}
+
+	// bad durations are reported when loading the config
+	dir := t.TempDir()
+	err := os.WriteFile(
+		filepath.Join(dir, projectConfigName),
+		[]byte(`{"plugins": {"sample": {"timeout": "forever"}}}`),
+		0644,
+	)
+	require.NoError(t, err)
+
+	_, err = loadProjectConfig("", dir)
+	assert.ErrorContains(t, err, "invalid config file")
+}
+
+func TestLoadProjectConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "custom.json")
+	err := os.WriteFile(path, []byte(`{"plugin_dir": "plugins"}`), 0644)
+	require.NoError(t, err)
+
+	// a missing config in the lock directory is an empty config
+	cfg, err := loadProjectConfig("", dir)
+	require.NoError(t, err)
+	assert.Equal(t, &projectConfig{}, cfg)
+
+	// a config passed using --config must exist
+	_, err = loadProjectConfig(filepath.Join(dir, "missing.json"), dir)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	cfg, err = loadProjectConfig(path, dir)
+	require.NoError(t, err)
+	assert.Equal(t, "plugins", cfg.PluginDir)
+}
+
+func TestProjectConfigPluginTimeout(t *testing.T) {
+	cfg := &projectConfig{
+		Plugins: map[string]pluginConfig{
+			"slow": {Timeout: duration{time.Minute}},
+			"wasm": {AllowedHosts: []string{"example.com"}},
+		},
+	}
+
+	// the plugin's timeout overrides --plugintimeout
+	assert.Equal(t, time.Minute, cfg.plugin("slow", time.Second).Timeout.Duration)
+	assert.Equal(t, time.Second, cfg.plugin("wasm", time.Second).Timeout.Duration)
+	assert.Equal(t, []string{"example.com"}, cfg.plugin("wasm", time.Second).AllowedHosts)
+	assert.Equal(t, time.Second, cfg.plugin("other", time.Second).Timeout.Duration)
+
+	empty := &projectConfig{}
+	assert.Equal(t, time.Duration(0), empty.plugin("slow", 0).Timeout.Duration)
+}
+
+func TestProjectConfigRegisterRules(t *testing.T) {
+	cfg := &projectConfig{}
+	err := json.Unmarshal([]byte(`{
+  "rules": [
+    {"name": "NoBytesFields", "scope": "field", "require": "type != \"bytes\""},
+    {"name": "NoRequiredFields", "scope": "field", "require": "!requird"}
+  ]
+}`), cfg)
+	require.NoError(t, err)
+
+	// a typo in an attribute name fails once, naming the rule, rather than
+	// for each entity the rule checks
+	err = cfg.registerRules(protolock.NewEngine(protolock.EngineOptions{}))
+	assert.ErrorIs(t, err, protolock.ErrInvalidRule)
+	assert.ErrorContains(t, err, `"NoRequiredFields": require: unknown field attribute "requird"`)
+
+	cfg.Rules = cfg.Rules[:1]
+	assert.NoError(t, cfg.registerRules(protolock.NewEngine(protolock.EngineOptions{})))
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nilslice/protolock/extend"
+)
+
+const (
+	// pluginPrefix is the file name prefix of native plugins discovered on
+	// the user's PATH.
+	pluginPrefix = "protolock-plugin-"
+
+	// defaultPluginDir is where WASM plugins are discovered, relative to the
+	// lock directory, unless "plugin_dir" is set in the project config.
+	defaultPluginDir = ".protolock/plugins"
+
+	wasmExt     = ".wasm"
+	manifestExt = ".json"
+
+	// defaultWasmEntry is the function called on a WASM plugin when its
+	// manifest does not specify an entry function.
+	defaultWasmEntry = "status"
+)
+
+// pluginManifest describes a plugin, and is read from a JSON file next to the
+// plugin sharing its name, e.g. "style.json" for "style.wasm".
+type pluginManifest struct {
+	Name        string `json:"name,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Entry is the function called on a WASM plugin, defaulting to "status".
+	Entry string `json:"entry,omitempty"`
+	// Capabilities declares what a native plugin supports before it is run,
+	// which must include "commit-hook" for it to be run by commit.
+	Capabilities []extend.Capability `json:"capabilities,omitempty"`
+	// Config is the default key/value config passed to a WASM plugin, which
+	// is overridden by the plugin's config in the project config.
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// pluginTarget is a plugin resolved from a name provided to --plugins, or
+// found through discovery.
+type pluginTarget struct {
+	name string
+	// file is the name derived from the plugin's file name, which differs
+	// from name if the plugin's manifest names it.
+	file     string
+	path     string
+	wasm     bool
+	manifest *pluginManifest
+}
+
+// entry returns the function to call on a WASM plugin.
+func (t pluginTarget) entry() string {
+	if t.manifest != nil && t.manifest.Entry != "" {
+		return t.manifest.Entry
+	}
+	return defaultWasmEntry
+}
+
+// declares reports whether the plugin's manifest declares the capability.
+func (t pluginTarget) declares(c extend.Capability) bool {
+	if t.manifest == nil {
+		return false
+	}
+	h := &extend.Handshake{Capabilities: t.manifest.Capabilities}
+	return h.HasCapability(c)
+}
+
+// matches reports whether the plugin is named name, by either its manifest or
+// its file name.
+func (t pluginTarget) matches(name string) bool {
+	return t.name == name || t.file == name
+}
+
+// pluginDir returns the directory WASM plugins are discovered in.
+func (cfg *projectConfig) pluginDir(lockDir string) string {
+	dir := cfg.PluginDir
+	if dir == "" {
+		dir = defaultPluginDir
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(lockDir, dir)
+}
+
+// discoverPlugins finds all native plugins named with pluginPrefix on the
+// user's PATH, and all WASM plugins in pluginDir. Native plugins earlier in
+// the PATH take precedence over later ones with the same name.
+func discoverPlugins(pluginDir string) ([]pluginTarget, error) {
+	var targets []pluginTarget
+	seen := make(map[string]bool)
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), pluginPrefix) {
+				continue
+			}
+			if strings.HasSuffix(entry.Name(), manifestExt) {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			if _, err := exec.LookPath(path); err != nil {
+				continue
+			}
+
+			target, err := newPluginTarget(pluginName(entry.Name()), path, false)
+			if err != nil {
+				return nil, err
+			}
+			if seen[target.name] {
+				continue
+			}
+			seen[target.name] = true
+			targets = append(targets, target)
+		}
+	}
+
+	entries, err := os.ReadDir(pluginDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), wasmExt) {
+			continue
+		}
+
+		path := filepath.Join(pluginDir, entry.Name())
+		target, err := newPluginTarget(pluginName(entry.Name()), path, true)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].name < targets[j].name
+	})
+
+	return targets, nil
+}
+
+// resolvePlugin finds the plugin to run for a name provided to --plugins. A
+// path to a .wasm file, or the name of an executable on the PATH, is used
+// as-is. Otherwise the name is matched against the plugins returned by
+// discover, which is only called if needed.
+func resolvePlugin(
+	name string,
+	discover func() ([]pluginTarget, error),
+) (pluginTarget, error) {
+	if strings.HasSuffix(name, wasmExt) {
+		return newPluginTarget(name, name, true)
+	}
+
+	path, lookErr := exec.LookPath(name)
+	if lookErr == nil {
+		return newPluginTarget(name, path, false)
+	}
+
+	targets, err := discover()
+	if err != nil {
+		return pluginTarget{}, err
+	}
+	for _, target := range targets {
+		if target.matches(name) {
+			return target, nil
+		}
+	}
+
+	return pluginTarget{}, lookErr
+}
+
+// newPluginTarget returns a pluginTarget for the plugin at path, reading its
+// manifest if one exists.
+func newPluginTarget(name, path string, wasm bool) (pluginTarget, error) {
+	manifest, err := readPluginManifest(path)
+	if err != nil {
+		return pluginTarget{}, err
+	}
+	file := pluginName(filepath.Base(path))
+	if manifest != nil && manifest.Name != "" && name == file {
+		name = manifest.Name
+	}
+
+	return pluginTarget{
+		name:     name,
+		file:     file,
+		path:     path,
+		wasm:     wasm,
+		manifest: manifest,
+	}, nil
+}
+
+// pluginName derives a plugin's name from its file name, removing the plugin
+// prefix and any file extension.
+func pluginName(file string) string {
+	name := strings.TrimPrefix(file, pluginPrefix)
+	name = strings.TrimSuffix(name, wasmExt)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// readPluginManifest reads the manifest for the plugin at path, returning nil
+// if the plugin has no manifest.
+func readPluginManifest(path string) (*pluginManifest, error) {
+	base := strings.TrimSuffix(path, wasmExt)
+	if runtime.GOOS == "windows" {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	b, err := os.ReadFile(base + manifestExt)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	manifest := &pluginManifest{}
+	if err := json.Unmarshal(b, manifest); err != nil {
+		return nil, fmt.Errorf("invalid plugin manifest %s: %v", base+manifestExt, err)
+	}
+
+	return manifest, nil
+}
+
+// listPlugins writes a table of all discovered plugins to w.
+func listPlugins(w io.Writer, pluginDir string) error {
+	targets, err := discoverPlugins(pluginDir)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLUGIN\tTYPE\tVERSION\tPATH\tDESCRIPTION")
+	for _, target := range targets {
+		kind := "native"
+		if target.wasm {
+			kind = "wasm"
+		}
+
+		var version, description string
+		if target.manifest != nil {
+			version = target.manifest.Version
+			description = target.manifest.Description
+		}
+
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\n",
+			target.name, kind, version, target.path, description,
+		)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestFile writes a file for a test, creating its directory.
+func writeTestFile(t *testing.T, path, content string, perm os.FileMode) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), perm))
+}
+
+// setupTestPlugins creates native plugins in two directories on a temporary
+// PATH, and WASM plugins in a plugin dir. It returns the plugin dir, and the
+// first directory on the PATH.
+func setupTestPlugins(t *testing.T) (pluginDir, binDir string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("native test plugins are shell scripts")
+	}
+
+	tmp := t.TempDir()
+	binDir = filepath.Join(tmp, "bin")
+	shadowedDir := filepath.Join(tmp, "shadowed")
+	pluginDir = filepath.Join(tmp, "plugins")
+
+	script := "#!/bin/sh\ncat\n"
+	writeTestFile(t, filepath.Join(binDir, "protolock-plugin-style"), script, 0755)
+	writeTestFile(t, filepath.Join(binDir, "protolock-plugin-style.json"),
+		`{"name": "lint-style", "version": "1.0.0", "description": "Checks style"}`, 0644)
+	writeTestFile(t, filepath.Join(binDir, "protolock-plugin-docs"), script, 0755)
+	writeTestFile(t, filepath.Join(binDir, "other-tool"), script, 0755)
+	writeTestFile(t, filepath.Join(shadowedDir, "protolock-plugin-docs"), script, 0755)
+	writeTestFile(t, filepath.Join(shadowedDir, "protolock-plugin-data"), script, 0644)
+
+	writeTestFile(t, filepath.Join(pluginDir, "breaking.wasm"), "", 0644)
+	writeTestFile(t, filepath.Join(pluginDir, "breaking.json"),
+		`{"version": "0.2.0", "entry": "check"}`, 0644)
+	writeTestFile(t, filepath.Join(pluginDir, "README.md"), "", 0644)
+
+	t.Setenv("PATH", strings.Join([]string{binDir, shadowedDir}, string(os.PathListSeparator)))
+
+	return pluginDir, binDir
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	pluginDir, binDir := setupTestPlugins(t)
+
+	targets, err := discoverPlugins(pluginDir)
+	require.NoError(t, err)
+
+	// plugins are sorted by name, the first native plugin on the PATH is
+	// used, and non-executable files are skipped
+	var names, paths []string
+	for _, target := range targets {
+		names = append(names, target.name)
+		paths = append(paths, target.path)
+	}
+	assert.Equal(t, []string{"breaking", "docs", "lint-style"}, names)
+	assert.Equal(t, []string{
+		filepath.Join(pluginDir, "breaking.wasm"),
+		filepath.Join(binDir, "protolock-plugin-docs"),
+		filepath.Join(binDir, "protolock-plugin-style"),
+	}, paths)
+
+	assert.True(t, targets[0].wasm)
+	assert.Equal(t, "check", targets[0].entry())
+	assert.False(t, targets[1].wasm)
+	assert.Equal(t, defaultWasmEntry, targets[1].entry())
+	assert.Equal(t, "style", targets[2].file)
+
+	// a missing plugin dir has no WASM plugins
+	targets, err = discoverPlugins(filepath.Join(pluginDir, "missing"))
+	require.NoError(t, err)
+	assert.Len(t, targets, 2)
+}
+
+func TestResolvePlugin(t *testing.T) {
+	pluginDir, binDir := setupTestPlugins(t)
+
+	tests := []struct {
+		name     string
+		plugin   string
+		want     string
+		path     string
+		wasm     bool
+		discover bool
+		err      error
+	}{
+		{
+			name:   "path to a WASM file",
+			plugin: "other/check.wasm",
+			want:   "other/check.wasm",
+			path:   "other/check.wasm",
+			wasm:   true,
+		},
+		{
+			name:   "executable on the PATH",
+			plugin: "other-tool",
+			want:   "other-tool",
+			path:   filepath.Join(binDir, "other-tool"),
+		},
+		{
+			name:   "native plugin by file name",
+			plugin: "protolock-plugin-docs",
+			want:   "protolock-plugin-docs",
+			path:   filepath.Join(binDir, "protolock-plugin-docs"),
+		},
+		{
+			name:     "discovered native plugin",
+			plugin:   "docs",
+			want:     "docs",
+			path:     filepath.Join(binDir, "protolock-plugin-docs"),
+			discover: true,
+		},
+		{
+			name:     "discovered plugin by manifest name",
+			plugin:   "lint-style",
+			want:     "lint-style",
+			path:     filepath.Join(binDir, "protolock-plugin-style"),
+			discover: true,
+		},
+		{
+			name:     "discovered plugin by file-derived name",
+			plugin:   "style",
+			want:     "lint-style",
+			path:     filepath.Join(binDir, "protolock-plugin-style"),
+			discover: true,
+		},
+		{
+			name:     "discovered WASM plugin",
+			plugin:   "breaking",
+			want:     "breaking",
+			path:     filepath.Join(pluginDir, "breaking.wasm"),
+			wasm:     true,
+			discover: true,
+		},
+		{
+			name:     "unknown plugin",
+			plugin:   "missing",
+			discover: true,
+			err:      exec.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discovered := 0
+			target, err := resolvePlugin(tt.plugin, func() ([]pluginTarget, error) {
+				discovered++
+				return discoverPlugins(pluginDir)
+			})
+			assert.Equal(t, tt.discover, discovered == 1)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, target.name)
+			assert.Equal(t, tt.path, target.path)
+			assert.Equal(t, tt.wasm, target.wasm)
+		})
+	}
+
+	discoverErr := errors.New("discovery failed")
+	_, err := resolvePlugin("missing", func() ([]pluginTarget, error) {
+		return nil, discoverErr
+	})
+	assert.ErrorIs(t, err, discoverErr)
+}
+
+func TestPluginName(t *testing.T) {
+	for file, want := range map[string]string{
+		"protolock-plugin-style":  "style",
+		"style.wasm":              "style",
+		"protolock-plugin-x.wasm": "x",
+		"other-tool":              "other-tool",
+	} {
+		assert.Equal(t, want, pluginName(file), file)
+	}
+}
+
+func TestReadPluginManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "style.json"),
+		`{"name": "lint-style", "entry": "check", "config": {"case": "snake"}}`, 0644)
+	writeTestFile(t, filepath.Join(dir, "protolock-plugin-docs.json"),
+		`{"version": "1.0.0"}`, 0644)
+	writeTestFile(t, filepath.Join(dir, "broken.json"), `{"name": `, 0644)
+
+	tests := []struct {
+		name string
+		path string
+		want *pluginManifest
+		err  string
+	}{
+		{
+			name: "WASM plugin",
+			path: filepath.Join(dir, "style.wasm"),
+			want: &pluginManifest{
+				Name:   "lint-style",
+				Entry:  "check",
+				Config: map[string]string{"case": "snake"},
+			},
+		},
+		{
+			name: "native plugin",
+			path: filepath.Join(dir, "protolock-plugin-docs"),
+			want: &pluginManifest{Version: "1.0.0"},
+		},
+		{
+			name: "no manifest",
+			path: filepath.Join(dir, "missing.wasm"),
+		},
+		{
+			name: "invalid manifest",
+			path: filepath.Join(dir, "broken.wasm"),
+			err:  "invalid plugin manifest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := readPluginManifest(tt.path)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, manifest)
+		})
+	}
+}
+
+func TestListPlugins(t *testing.T) {
+	pluginDir, binDir := setupTestPlugins(t)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, listPlugins(out, pluginDir))
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		rows = append(rows, strings.Fields(line))
+	}
+	assert.Equal(t, [][]string{
+		{"PLUGIN", "TYPE", "VERSION", "PATH", "DESCRIPTION"},
+		{"breaking", "wasm", "0.2.0", filepath.Join(pluginDir, "breaking.wasm")},
+		{"docs", "native", filepath.Join(binDir, "protolock-plugin-docs")},
+		{
+			"lint-style", "native", "1.0.0",
+			filepath.Join(binDir, "protolock-plugin-style"), "Checks", "style",
+		},
+	}, rows)
+}
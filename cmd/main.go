@@ -0,0 +1,377 @@
+// Package cmd implements the protolock command line interface, and can be used
+// to build a protolock binary with additional rules.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nilslice/protolock"
+	"github.com/nilslice/protolock/extend"
+)
+
+const info = `Track your .proto files and prevent changes to messages and services which impact API compatibility.
+
+Copyright Steve Manuel <nilslice@gmail.com>
+Released under the BSD-3-Clause license.
+`
+
+const usage = `
+Usage:
+	protolock <command> [options]
+
+Commands:
+	-h, --help, help	display the usage information for protolock
+	init			initialize a proto.lock file from current tree
+	status			check for breaking changes and report conflicts
+	commit			rewrite proto.lock file with current tree if no conflicts (--force to override)
+	migrate			rewrite proto.lock file in the current lock format
+	merge-driver %O %A %B	merge proto.lock files as a git merge driver, see README
+	plugins list		list plugins discovered on the PATH and in the project plugin directory
+
+Options:
+	--strict [true]		enable strict mode and enforce all built-in rules
+	--debug	[false]		enable debug mode and output debug messages
+	--ignore 		comma-separated list of filepaths to ignore
+	--force [false]		forces commit to rewrite proto.lock file and disregards warnings
+	--plugins 		comma-separated list of executable protolock plugin names
+	--lockdir [.]		directory of proto.lock file
+	--protoroot [.]		comma-separated list of roots of directory trees containing proto files
+	--include		comma-separated list of include-only proto roots, used to resolve imported types
+	--uptodate [false]	enforce that proto.lock file is up-to-date with proto files
+	--sensitiveoptions	comma-separated list of option names which must not change (overrides defaults)
+	--profile		compatibility profile to enforce: wire, json, or source (default: all rules)
+	--plugintimeout [0]	maximum run time of each plugin, e.g. 30s (0 for no limit)
+	--config		path to project config file (default: .protolock.json in lockdir)
+`
+
+var (
+	options   = flag.NewFlagSet("options", flag.ExitOnError)
+	debug     = options.Bool("debug", false, "toggle debug mode for verbose output")
+	strict    = options.Bool("strict", true, "enable strict mode and enforce all built-in rules")
+	ignore    = options.String("ignore", "", "comma-separated list of filepaths to ignore")
+	force     = options.Bool("force", false, "force commit to rewrite proto.lock file and disregard warnings")
+	plugins   = options.String("plugins", "", "comma-separated list of executable protolock plugin names")
+	lockDir   = options.String("lockdir", ".", "directory of proto.lock file")
+	protoRoot = options.String("protoroot", ".", "comma-separated list of roots of directory trees containing proto files")
+	include   = options.String("include", "", "comma-separated list of include-only proto roots, used to resolve imported types")
+	upToDate  = options.Bool("uptodate", false, "enforce that proto.lock file is up-to-date with proto files")
+	sensOpts  = options.String("sensitiveoptions", "", "comma-separated list of option names which must not change (overrides defaults)")
+	profile   = options.String("profile", "", "compatibility profile to enforce: wire, json, or source (default: all rules)")
+	plgnTmout = options.Duration("plugintimeout", 0, "maximum run time of each plugin, e.g. 30s (0 for no limit)")
+	config    = options.String("config", "", "path to project config file (default: .protolock.json in lockdir)")
+)
+
+// Main runs the protolock command line interface, enforcing extraRules in
+// addition to the built-in Rules. It enables teams to build their own
+// protolock binary with rules compiled in:
+//
+//	func main() {
+//		cmd.Main(protolock.Rule{
+//			Name:        "NoRemovingMessages",
+//			Description: "Messages must not be removed.",
+//			Func:        noRemovingMessages,
+//		})
+//	}
+func Main(extraRules ...protolock.Rule) {
+	// exit if no command (i.e. help, -h, --help, init, status, or commit)
+	if len(os.Args) < 2 {
+		fmt.Print(info + usage)
+		os.Exit(0)
+	}
+
+	// parse and set options flags, which follow the subcommand of commands
+	// such as "plugins list", or the arguments of "merge-driver"
+	args := os.Args[2:]
+	switch {
+	case os.Args[1] == "plugins" && len(args) > 0:
+		args = args[1:]
+	case os.Args[1] == "merge-driver" && len(args) >= 3:
+		args = args[3:]
+	}
+	options.Parse(args)
+	protolock.SetDebug(*debug)
+	protolock.SetLogger(log.New(os.Stdout, "", 0))
+
+	p, err := protolock.ParseProfile(*profile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// the engine runs the built-in rules, and any extra rules compiled in to
+	// the binary or declared in the project config
+	engine := protolock.NewEngine(protolock.EngineOptions{
+		Strict:  *strict,
+		Profile: p,
+	})
+	if *debug {
+		engine.Debug = os.Stdout
+	}
+
+	for _, rule := range extraRules {
+		err := engine.RegisterRule(rule)
+		if err != nil {
+			fmt.Println(logPrefix, "error:", err)
+			os.Exit(1)
+		}
+	}
+
+	// the first proto root is the config's ProtoRoot, and any others are
+	// locked along with it, while include-only roots are only used to
+	// resolve imported types
+	protoRoots := strings.Split(*protoRoot, ",")
+	cfg, err := protolock.NewConfig(
+		*lockDir,
+		protoRoots[0],
+		*ignore,
+		*upToDate,
+		*debug,
+	)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	cfg.ProtoFS = os.DirFS(cfg.ProtoRoot)
+	cfg.Engine = engine
+
+	for _, dir := range protoRoots[1:] {
+		cfg.Roots = append(cfg.Roots, protolock.Root{Dir: dir})
+	}
+	if *include != "" {
+		for _, dir := range strings.Split(*include, ",") {
+			cfg.Roots = append(cfg.Roots, protolock.Root{Dir: dir, IncludeOnly: true})
+		}
+	}
+
+	// load the project config, and enforce any rules it declares in addition
+	// to the built-in rules
+	projCfg, err := loadProjectConfig(*config, cfg.LockDir)
+	if err != nil {
+		fmt.Println(logPrefix, "error:", err)
+		os.Exit(1)
+	}
+	engine.SetSensitiveOptions(projCfg.sensitiveOptions(*sensOpts))
+
+	err = projCfg.registerRules(engine)
+	if err != nil {
+		fmt.Println(logPrefix, "error:", err)
+		os.Exit(1)
+	}
+
+	cfg.Layout, err = protolock.ParseLockLayout(projCfg.LockLayout)
+	if err != nil {
+		fmt.Println(logPrefix, "error:", err)
+		os.Exit(1)
+	}
+
+	// switch through known commands
+	switch os.Args[1] {
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+
+	case "init":
+		r, err := protolock.Init(*cfg)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = saveToLockFile(*cfg, r)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+	case "commit":
+		// if force option is false (default), then disallow commit if
+		// there are any warnings encountered by runing a status check.
+		if !*force {
+			status(cfg, projCfg)
+		}
+
+		r, err := protolock.Commit(*cfg)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// if plugins are provided, run those which are commit hooks before
+		// and after the proto.lock file is written, passing in the current
+		// and new lock contents
+		var current, updated protolock.Protolock
+		if *plugins != "" {
+			current, updated, r, err = readCommitLocks(cfg, r)
+			if err != nil {
+				fmt.Println(logPrefix, "error:", err)
+				os.Exit(1)
+			}
+
+			commitHook(cfg, projCfg, extend.ModePreCommit, current, updated)
+		}
+
+		err = saveToLockFile(*cfg, r)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if *plugins != "" {
+			commitHook(cfg, projCfg, extend.ModePostCommit, current, updated)
+		}
+
+	case "status":
+		status(cfg, projCfg)
+
+	case "migrate":
+		r, err := protolock.Migrate(*cfg)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = saveToLockFile(*cfg, r)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+	case "merge-driver":
+		if len(os.Args) < 5 {
+			fmt.Println(logPrefix, "error: usage: protolock merge-driver <base> <ours> <theirs>")
+			os.Exit(1)
+		}
+
+		code := mergeDriver(os.Stdout, os.Args[2], os.Args[3], os.Args[4])
+		if code != 0 {
+			os.Exit(code)
+		}
+
+	case "plugins":
+		if len(os.Args) < 3 || os.Args[2] != "list" {
+			fmt.Println(logPrefix, "error: unknown plugins command, use 'protolock plugins list'")
+			os.Exit(1)
+		}
+
+		err = listPlugins(os.Stdout, projCfg.pluginDir(cfg.LockDir))
+		if err != nil {
+			fmt.Println(logPrefix, "error:", err)
+			os.Exit(1)
+		}
+
+	default:
+		os.Exit(0)
+	}
+}
+
+func status(cfg *protolock.Config, projCfg *projectConfig) {
+	report, err := protolock.Status(*cfg)
+	if err == protolock.ErrOutOfDate {
+		fmt.Println(logPrefix, "error:", err, "run 'protolock commit'")
+		// only exit if flag provided for backwards compatibility
+		if cfg.UpToDate {
+			os.Exit(2)
+		}
+		// don't report the error twice
+		err = nil
+	}
+	if err != protolock.ErrWarningsFound && err != nil {
+		fmt.Println(logPrefix, "error:", err)
+		os.Exit(1)
+	}
+	// if plugins are provided, attempt to execute each as a executable
+	// located in the user's OS executable path as reported by stdlib's
+	// exec.LookPath func, or as a plugin found by discovery
+	if *plugins != "" {
+		report, err = runPlugins(
+			context.Background(), extend.ModeStatus, *plugins, report, projCfg,
+			projCfg.pluginDir(cfg.LockDir), *plgnTmout, *debug,
+		)
+		if err != nil {
+			fmt.Println(logPrefix, "error:", err)
+			os.Exit(1)
+		}
+	}
+
+	code, err := protolock.HandleReport(report, os.Stdout, err)
+	if err != protolock.ErrWarningsFound && err != nil {
+		fmt.Println(logPrefix, "error:", err)
+		os.Exit(1)
+	}
+
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// readCommitLocks returns the current proto.lock contents, and the updated
+// contents read from r, along with a new reader of the updated contents.
+func readCommitLocks(
+	cfg *protolock.Config, r io.Reader,
+) (protolock.Protolock, protolock.Protolock, io.Reader, error) {
+	var current, updated protolock.Protolock
+
+	lock, err := io.ReadAll(r)
+	if err != nil {
+		return current, updated, nil, err
+	}
+
+	updated, err = protolock.FromReader(bytes.NewReader(lock))
+	if err != nil {
+		return current, updated, nil, err
+	}
+
+	current, err = protolock.ReadLock(*cfg)
+	if err != nil {
+		return current, updated, nil, err
+	}
+
+	return current, updated, bytes.NewReader(lock), nil
+}
+
+// commitHook runs the plugins which are commit hooks in the given mode, and
+// exits if any report an error. Pre-commit warnings are disregarded when
+// committing with --force.
+func commitHook(
+	cfg *protolock.Config,
+	projCfg *projectConfig,
+	mode extend.Mode,
+	current, updated protolock.Protolock,
+) {
+	report, err := runPlugins(
+		context.Background(), mode, *plugins,
+		&protolock.Report{Current: current, Updated: updated},
+		projCfg, projCfg.pluginDir(cfg.LockDir), *plgnTmout, *debug,
+	)
+	if err != nil {
+		fmt.Println(logPrefix, mode, "error:", err)
+		os.Exit(1)
+	}
+
+	code, err := protolock.HandleReport(report, os.Stdout, nil)
+	if err != protolock.ErrWarningsFound && err != nil {
+		fmt.Println(logPrefix, "error:", err)
+		os.Exit(1)
+	}
+
+	if code != 0 && (mode != extend.ModePreCommit || !*force) {
+		os.Exit(code)
+	}
+}
+
+// saveToLockFile saves the lock read from r to the proto.lock file, or to the
+// shards of a sharded lock layout.
+func saveToLockFile(cfg protolock.Config, r io.Reader) error {
+	lock, err := protolock.FromReader(r)
+	if err != nil {
+		return err
+	}
+
+	return protolock.SaveLock(cfg, lock)
+}
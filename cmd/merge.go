@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nilslice/protolock"
+)
+
+// mergeDriver runs the merge-driver command with the %O, %A and %B paths
+// given by git, and returns its exit code, which is non-zero if the files
+// cannot be merged. Errors, including the conflicts, are written to w.
+func mergeDriver(w io.Writer, basePath, oursPath, theirsPath string) int {
+	err := mergeLockFiles(basePath, oursPath, theirsPath)
+	if err != nil {
+		fmt.Fprintln(w, logPrefix, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// mergeLockFiles merges the changes made to the proto.lock file at basePath by
+// the files at oursPath and theirsPath, and writes the result to oursPath, as
+// expected of a git merge driver. oursPath is left unchanged if the files
+// cannot be merged.
+func mergeLockFiles(basePath, oursPath, theirsPath string) error {
+	var locks [3]protolock.Protolock
+	for i, path := range []string{basePath, oursPath, theirsPath} {
+		lock, err := readLockFile(path)
+		if err != nil {
+			return err
+		}
+		locks[i] = lock
+	}
+
+	merged, err := protolock.Merge(locks[0], locks[1], locks[2])
+	if err != nil {
+		return err
+	}
+
+	b, err := protolock.MarshalLock(*merged)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(oursPath, b, 0666)
+}
+
+// readLockFile reads the proto.lock file at path. An empty file, such as the
+// common ancestor git provides for files added on both sides, is an empty
+// Protolock.
+func readLockFile(path string) (protolock.Protolock, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return protolock.Protolock{}, err
+	}
+	if len(b) == 0 {
+		return protolock.Protolock{}, nil
+	}
+
+	return protolock.FromReader(bytes.NewReader(b))
+}
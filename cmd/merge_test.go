@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nilslice/protolock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lockJSON returns a proto.lock file defining a message with the fields,
+// which are numbered in order.
+func lockJSON(fields ...string) string {
+	var defs []string
+	for i, name := range fields {
+		defs = append(defs, fmt.Sprintf(
+			`{"id": %d, "name": %q, "type": "string"}`, i+1, name,
+		))
+	}
+	return fmt.Sprintf(`{
+  "definitions": [
+    {
+      "protopath": "test.proto",
+      "def": {
+        "messages": [{"name": "Channel", "fields": [%s]}],
+        "package": {"name": "test"}
+      }
+    }
+  ]
+}`, strings.Join(defs, ", "))
+}
+
+func TestMergeDriver(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		code               int
+		fields             []string
+	}{
+		{
+			name:   "both sides change different fields",
+			base:   lockJSON("id", "name", "topic"),
+			ours:   lockJSON("id", "title", "topic"),
+			theirs: lockJSON("id", "name"),
+			fields: []string{"id", "title"},
+		},
+		{
+			name:   "empty ancestor of a file added on both sides",
+			base:   "",
+			ours:   lockJSON("id"),
+			theirs: lockJSON("id"),
+			fields: []string{"id"},
+		},
+		{
+			name:   "conflicting fields",
+			base:   lockJSON("id"),
+			ours:   lockJSON("id", "name"),
+			theirs: lockJSON("id", "topic"),
+			code:   1,
+		},
+		{
+			name:   "malformed theirs",
+			base:   lockJSON("id"),
+			ours:   lockJSON("id", "name"),
+			theirs: "{",
+			code:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			base := filepath.Join(dir, "base")
+			ours := filepath.Join(dir, "ours")
+			theirs := filepath.Join(dir, "theirs")
+			require.NoError(t, os.WriteFile(base, []byte(test.base), 0644))
+			require.NoError(t, os.WriteFile(ours, []byte(test.ours), 0644))
+			require.NoError(t, os.WriteFile(theirs, []byte(test.theirs), 0644))
+
+			out := &bytes.Buffer{}
+			code := mergeDriver(out, base, ours, theirs)
+			assert.Equal(t, test.code, code)
+
+			b, err := os.ReadFile(ours)
+			require.NoError(t, err)
+
+			if test.code != 0 {
+				// %A is left untouched, so git reports the conflict
+				assert.Equal(t, test.ours, string(b))
+				assert.Contains(t, out.String(), "error:")
+				return
+			}
+
+			// the result is written to %A in the canonical encoding
+			assert.Empty(t, out.String())
+			merged, err := protolock.FromReader(bytes.NewReader(b))
+			require.NoError(t, err)
+			expected, err := protolock.MarshalLock(merged)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(b))
+
+			var names []string
+			for _, f := range merged.Definitions[0].Def.Messages[0].Fields {
+				names = append(names, f.Name)
+			}
+			assert.Equal(t, test.fields, names)
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/nilslice/protolock"
+	"github.com/nilslice/protolock/extend"
+	"github.com/tetratelabs/wazero"
+)
+
+const logPrefix = "[protolock]"
+
+// pluginWaitDelay bounds how long a plugin's output is read after its process
+// has been killed on timeout.
+const pluginWaitDelay = time.Second
+
+// runPlugins runs each plugin in the comma-separated pluginList in the given
+// mode, adding their warnings to the report.
+func runPlugins(
+	ctx context.Context,
+	mode extend.Mode,
+	pluginList string,
+	report *protolock.Report,
+	cfg *projectConfig,
+	pluginDir string,
+	defaultTimeout time.Duration,
+	debug bool,
+) (*protolock.Report, error) {
+	inputData := &bytes.Buffer{}
+
+	err := json.NewEncoder(inputData).Encode(&extend.Data{
+		Current:           report.Current,
+		Updated:           report.Updated,
+		ProtolockWarnings: report.Warnings,
+		PluginWarnings:    []protolock.Warning{},
+		ProtocolVersion:   extend.ProtocolVersion,
+		Mode:              mode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// collect plugin warnings and errors as they are returned from plugins
+	pluginWarningsChan := make(chan []protolock.Warning)
+	pluginsDone := make(chan struct{})
+	pluginErrsChan := make(chan error)
+	var allPluginErrors []error
+	go func() {
+		for {
+			select {
+			case <-pluginsDone:
+				return
+
+			case err := <-pluginErrsChan:
+				if err != nil {
+					allPluginErrors = append(allPluginErrors, err)
+				}
+
+			case warnings := <-pluginWarningsChan:
+				for _, warning := range warnings {
+					report.Warnings = append(report.Warnings, warning)
+				}
+			}
+		}
+	}()
+
+	// plugins are discovered at most once, however many need resolving
+	discover := sync.OnceValues(func() ([]pluginTarget, error) {
+		return discoverPlugins(pluginDir)
+	})
+
+	wg := &sync.WaitGroup{}
+	plugins := strings.Split(pluginList, ",")
+	for _, name := range plugins {
+		wg.Add(1)
+
+		// copy input data to be passed in to and processed by each plugin
+		pluginInputData := bytes.NewReader(inputData.Bytes())
+
+		// run all provided plugins in parallel, each recieving the same current
+		// and updated Protolock structs from the `protolock status` call
+		go func(name string) {
+			defer wg.Done()
+			// output is populated either by the execution of an Extism plugin or a native binary
+			var output []byte
+			// stderr is only populated by native binaries, WASM plugins
+			// should use extend.Data.Log for diagnostics
+			var stderr []byte
+			var err error
+			name = strings.TrimSpace(name)
+			path := name
+			pluginCfg := cfg.plugin(name, defaultTimeout)
+
+			// resolve the plugin by path, executable name or by discovery
+			target, err := resolvePlugin(name, discover)
+			if err != nil {
+				pluginErrsChan <- wrapPluginErr(name, path, err, nil)
+				return
+			}
+			path = target.path
+
+			// native plugins only report their capabilities once run, so
+			// they must declare in their manifest that they are commit
+			// hooks, and are otherwise never run as one
+			if mode != extend.ModeStatus && !target.wasm &&
+				!target.declares(extend.CapabilityCommitHook) {
+				if debug {
+					fmt.Println(logPrefix, name, "skipped plugin: not a commit hook")
+				}
+				return
+			}
+
+			if debug {
+				fmt.Println(logPrefix, name, "running plugin:", mode)
+			}
+
+			// limit the plugin's execution time if a timeout is set, both
+			// native and WASM plugins are stopped once ctx is done
+			ctx := ctx
+			if pluginCfg.Timeout.Duration > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, pluginCfg.Timeout.Duration)
+				defer cancel()
+			}
+
+			if target.wasm {
+				// do extism call
+				manifest, extismCfg := wasmManifest(target, pluginCfg)
+				plugin, err := extism.NewPlugin(ctx, manifest, extismCfg, nil)
+				if err != nil {
+					pluginErrsChan <- wrapPluginErr(
+						name, path, fmt.Errorf("failed to create extism plugin: %v", err), nil,
+					)
+					return
+				}
+				defer plugin.Close()
+
+				// commit hooks are optional exports, and are only called on
+				// plugins which define them
+				fn := wasmFunc(mode, target)
+				if mode != extend.ModeStatus && !plugin.FunctionExists(fn) {
+					return
+				}
+
+				// plugins may export a "handshake" function, which is called
+				// to refuse incompatible plugins before any data is sent
+				if plugin.FunctionExists(wasmHandshakeFunc) {
+					err = wasmHandshake(plugin, mode.Capability())
+					if err != nil {
+						pluginErrsChan <- wrapPluginErr(name, path, err, nil)
+						return
+					}
+				}
+
+				var exitCode uint32
+				exitCode, output, err = plugin.Call(fn, inputData.Bytes())
+				if err != nil {
+					if ctx.Err() == context.DeadlineExceeded {
+						err = errPluginTimeout(pluginCfg.Timeout.Duration)
+					} else {
+						fmt.Println(logPrefix, name, "plugin exec error: ", err, "code:", exitCode)
+					}
+					pluginErrsChan <- wrapPluginErr(name, path, err, output)
+					return
+				}
+
+			} else {
+				// initialize the executable to be called from protolock using the
+				// absolute path and copy of the input data, the process is
+				// killed if ctx is done before it exits
+				plugin := exec.CommandContext(ctx, path)
+				plugin.Stdin = pluginInputData
+				// don't wait on output from any child processes which outlive
+				// a killed plugin
+				plugin.WaitDelay = pluginWaitDelay
+
+				// execute the plugin and capture its output, keeping stderr
+				// separate so that plugin logging cannot corrupt the data
+				// written to stdout
+				stdoutBuf, stderrBuf := &bytes.Buffer{}, &bytes.Buffer{}
+				plugin.Stdout = stdoutBuf
+				plugin.Stderr = stderrBuf
+				err = plugin.Run()
+				output, stderr = stdoutBuf.Bytes(), stderrBuf.Bytes()
+				if debug {
+					printPluginLines(name, "stderr:", string(stderr))
+				}
+				if err != nil {
+					if ctx.Err() == context.DeadlineExceeded {
+						err = errPluginTimeout(pluginCfg.Timeout.Duration)
+					}
+					pluginErrsChan <- wrapPluginErr(
+						name, path, err, append(output, stderr...),
+					)
+					return
+				}
+			}
+
+			pluginData := &extend.Data{}
+			err = json.Unmarshal(output, pluginData)
+			if err != nil {
+				pluginErrsChan <- wrapPluginErr(
+					name,
+					path,
+					fmt.Errorf("plugin data decode error: %v", err),
+					append(output, stderr...),
+				)
+				return
+			}
+
+			err = extend.Negotiate(pluginData.Handshake, mode.Capability())
+			if err != nil {
+				pluginErrsChan <- wrapPluginErr(name, path, err, nil)
+				return
+			}
+
+			if debug {
+				for _, line := range pluginData.PluginLogs {
+					printPluginLines(name, "log:", line)
+				}
+			}
+
+			// gather all warnings from each plugin, and send to warning chan
+			// collector as a slice to keep together, attributing any warning
+			// without a rule name to the plugin itself
+			for i := range pluginData.PluginWarnings {
+				if pluginData.PluginWarnings[i].RuleName == "" {
+					pluginData.PluginWarnings[i].RuleName = name
+				}
+			}
+			if pluginData.PluginWarnings != nil {
+				pluginWarningsChan <- pluginData.PluginWarnings
+			}
+
+			if pluginData.PluginErrorMessage != "" {
+				pluginErrsChan <- wrapPluginErr(
+					name,
+					path,
+					errors.New(pluginData.PluginErrorMessage),
+					output,
+				)
+			}
+		}(name)
+	}
+
+	wg.Wait()
+	pluginsDone <- struct{}{}
+
+	if allPluginErrors != nil {
+		var errorMsgs []string
+		for _, pluginError := range allPluginErrors {
+			errorMsgs = append(errorMsgs, pluginError.Error())
+		}
+
+		return nil, fmt.Errorf(
+			"accumulated plugin errors: \n%s",
+			strings.Join(errorMsgs, "\n"),
+		)
+	}
+
+	return report, nil
+}
+
+const (
+	wasmHandshakeFunc  = "handshake"
+	wasmPreCommitFunc  = "pre_commit"
+	wasmPostCommitFunc = "post_commit"
+)
+
+// wasmFunc returns the function called on a WASM plugin in the mode.
+func wasmFunc(mode extend.Mode, target pluginTarget) string {
+	switch mode {
+	case extend.ModePreCommit:
+		return wasmPreCommitFunc
+	case extend.ModePostCommit:
+		return wasmPostCommitFunc
+	default:
+		return target.entry()
+	}
+}
+
+// wasmHandshake calls the "handshake" function exported by a WASM plugin and
+// checks that the plugin is compatible with this version of protolock, and has
+// the required capability.
+func wasmHandshake(plugin *extism.Plugin, required extend.Capability) error {
+	_, output, err := plugin.Call(wasmHandshakeFunc, nil)
+	if err != nil {
+		return err
+	}
+
+	handshake := &extend.Handshake{}
+	err = json.Unmarshal(output, handshake)
+	if err != nil {
+		return fmt.Errorf("plugin handshake decode error: %v", err)
+	}
+
+	return extend.Negotiate(handshake, required)
+}
+
+// printPluginLines prints each line of output from a plugin, prefixed by the
+// plugin name and kind of output.
+func printPluginLines(name, kind, output string) {
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fmt.Println(logPrefix, name, kind, line)
+	}
+}
+
+// wasmManifest returns the Extism manifest and config used to create the WASM
+// plugin target, granting it the access allowed by its settings.
+func wasmManifest(
+	target pluginTarget, pluginCfg pluginConfig,
+) (extism.Manifest, extism.PluginConfig) {
+	manifest := extism.Manifest{
+		Wasm:         []extism.Wasm{extism.WasmFile{Path: target.path}},
+		AllowedHosts: pluginCfg.AllowedHosts,
+		AllowedPaths: pluginCfg.AllowedPaths,
+		Config:       mergeConfig(target.manifest, pluginCfg.Config),
+	}
+	manifest.Memory.MaxPages = pluginCfg.MemoryMaxPages
+
+	return manifest, extism.PluginConfig{
+		EnableWasi:    pluginCfg.wasiEnabled(),
+		RuntimeConfig: wazero.NewRuntimeConfig().WithCloseOnContextDone(true),
+	}
+}
+
+// mergeConfig returns the default config from a plugin's manifest, overridden
+// by the config set for the plugin in the project config.
+func mergeConfig(manifest *pluginManifest, config map[string]string) map[string]string {
+	if manifest == nil || len(manifest.Config) == 0 {
+		return config
+	}
+
+	merged := make(map[string]string, len(manifest.Config)+len(config))
+	for k, v := range manifest.Config {
+		merged[k] = v
+	}
+	for k, v := range config {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+func errPluginTimeout(timeout time.Duration) error {
+	return fmt.Errorf("plugin timed out after %s", timeout)
+}
+
+func wrapPluginErr(name, path string, err error, output []byte) error {
+	return fmt.Errorf(
+		"%s (%s): %v\n%s",
+		name, path, err, strings.ReplaceAll(
+			string(output),
+			protolock.ProtoSep, protolock.FileSep,
+		),
+	)
+}
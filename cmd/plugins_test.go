@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/nilslice/protolock"
+	"github.com/nilslice/protolock/extend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCountingPlugin writes a native plugin to dir which records each run in
+// a file, and replies with a handshake listing the capabilities. It returns
+// the path of the file recording the runs.
+func writeCountingPlugin(
+	t *testing.T, dir, name string, capabilities ...extend.Capability,
+) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("native test plugins are shell scripts")
+	}
+
+	var caps []string
+	for _, c := range capabilities {
+		caps = append(caps, fmt.Sprintf("%q", c))
+	}
+	runs := filepath.Join(dir, name+".runs")
+	writeTestFile(t, filepath.Join(dir, pluginPrefix+name), fmt.Sprintf(`#!/bin/sh
+cat > /dev/null
+echo run >> %s
+echo '{"handshake": {"protocol_versions": [%d], "capabilities": [%s]}}'
+`, runs, extend.ProtocolVersion, strings.Join(caps, ", ")), 0755)
+
+	return runs
+}
+
+// pluginRuns returns how many times a plugin written by writeCountingPlugin
+// was run.
+func pluginRuns(t *testing.T, runs string) int {
+	t.Helper()
+	b, err := os.ReadFile(runs)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	return strings.Count(string(b), "run\n")
+}
+
+func TestRunPluginsCommitHooks(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	statusRuns := writeCountingPlugin(t, dir, "status", extend.CapabilityStatus)
+	hookRuns := writeCountingPlugin(
+		t, dir, "hook", extend.CapabilityStatus, extend.CapabilityCommitHook,
+	)
+	writeTestFile(t, filepath.Join(dir, pluginPrefix+"hook.json"),
+		`{"capabilities": ["status", "commit-hook"]}`, 0644)
+
+	// a plugin is only run as a commit hook if its manifest declares it, so
+	// a status-only plugin runs once across a status and a commit
+	for _, mode := range []extend.Mode{
+		extend.ModeStatus, extend.ModePreCommit, extend.ModePostCommit,
+	} {
+		_, err := runPlugins(
+			context.Background(), mode, "status,hook", &protolock.Report{},
+			&projectConfig{}, filepath.Join(dir, "plugins"), 0, false,
+		)
+		require.NoError(t, err, mode)
+	}
+
+	assert.Equal(t, 1, pluginRuns(t, statusRuns))
+	assert.Equal(t, 3, pluginRuns(t, hookRuns))
+}
+
+func TestRunPluginsUndeclaredCommitHook(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	// the plugin's handshake must agree with its manifest
+	runs := writeCountingPlugin(t, dir, "status", extend.CapabilityStatus)
+	writeTestFile(t, filepath.Join(dir, pluginPrefix+"status.json"),
+		`{"capabilities": ["commit-hook"]}`, 0644)
+
+	_, err := runPlugins(
+		context.Background(), extend.ModePreCommit, "status", &protolock.Report{},
+		&projectConfig{}, filepath.Join(dir, "plugins"), time.Minute, false,
+	)
+	assert.ErrorContains(t, err, extend.ErrIncompatiblePlugin.Error())
+	assert.Equal(t, 1, pluginRuns(t, runs))
+}
+
+func TestRunPluginsTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("native test plugins are shell scripts")
+	}
+
+	sleep, err := exec.LookPath("sleep")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	writeTestFile(t, filepath.Join(dir, pluginPrefix+"slow"),
+		fmt.Sprintf("#!/bin/sh\nexec %s 30\n", sleep), 0755)
+
+	// the plugin's timeout overrides --plugintimeout, and the plugin is
+	// killed once it is exceeded
+	cfg := &projectConfig{
+		Plugins: map[string]pluginConfig{
+			"slow": {Timeout: duration{100 * time.Millisecond}},
+		},
+	}
+
+	start := time.Now()
+	_, err = runPlugins(
+		context.Background(), extend.ModeStatus, "slow", &protolock.Report{},
+		cfg, filepath.Join(dir, "plugins"), time.Minute, false,
+	)
+	assert.ErrorContains(t, err, errPluginTimeout(100*time.Millisecond).Error())
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestWasmManifest(t *testing.T) {
+	wasiOff := false
+	target := pluginTarget{
+		name: "style",
+		path: "plugins/style.wasm",
+		wasm: true,
+		manifest: &pluginManifest{
+			Config: map[string]string{"case": "snake", "max_length": "40"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		target    pluginTarget
+		pluginCfg pluginConfig
+		want      extism.Manifest
+		wasi      bool
+	}{
+		{
+			name:   "sandboxed by default",
+			target: pluginTarget{name: "check", path: "check.wasm", wasm: true},
+			want: extism.Manifest{
+				Wasm: []extism.Wasm{extism.WasmFile{Path: "check.wasm"}},
+			},
+			wasi: true,
+		},
+		{
+			name:   "manifest config",
+			target: target,
+			want: extism.Manifest{
+				Wasm: []extism.Wasm{extism.WasmFile{Path: "plugins/style.wasm"}},
+				Config: map[string]string{
+					"case": "snake", "max_length": "40",
+				},
+			},
+			wasi: true,
+		},
+		{
+			name:   "project config",
+			target: target,
+			pluginCfg: pluginConfig{
+				AllowedHosts:   []string{"api.example.com"},
+				AllowedPaths:   map[string]string{"docs/style.md": "/style.md"},
+				Config:         map[string]string{"max_length": "32"},
+				MemoryMaxPages: 256,
+				Wasi:           &wasiOff,
+			},
+			want: extism.Manifest{
+				Wasm:         []extism.Wasm{extism.WasmFile{Path: "plugins/style.wasm"}},
+				AllowedHosts: []string{"api.example.com"},
+				AllowedPaths: map[string]string{"docs/style.md": "/style.md"},
+				Config: map[string]string{
+					"case": "snake", "max_length": "32",
+				},
+			},
+			wasi: false,
+		},
+	}
+	tests[2].want.Memory.MaxPages = 256
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, extismCfg := wasmManifest(tt.target, tt.pluginCfg)
+			assert.Equal(t, tt.want, manifest)
+			assert.Equal(t, tt.wasi, extismCfg.EnableWasi)
+			assert.NotNil(t, extismCfg.RuntimeConfig)
+		})
+	}
+
+	// the plugin's manifest config is not modified by the project config
+	assert.Equal(t, "40", target.manifest.Config["max_length"])
+}
+
+// captureStdout returns what fn writes to stdout, where debug output from
+// plugins is printed.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+
+	fn()
+	require.NoError(t, w.Close())
+	return <-out
+}
+
+func TestRunPluginsStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("native test plugins are shell scripts")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	writeTestFile(t, filepath.Join(dir, pluginPrefix+"noisy"), `#!/bin/sh
+cat > /dev/null
+echo "checking style" >&2
+echo '{"plugin_warnings": [{"filepath": "test.proto", "message": "style issue"}]}'
+echo "checked style" >&2
+`, 0755)
+
+	// stderr is kept separate from the data written to stdout, and is only
+	// printed when debugging
+	for _, debug := range []bool{false, true} {
+		var report *protolock.Report
+		var err error
+		out := captureStdout(t, func() {
+			report, err = runPlugins(
+				context.Background(), extend.ModeStatus, "noisy", &protolock.Report{},
+				&projectConfig{}, filepath.Join(dir, "plugins"), time.Minute, debug,
+			)
+		})
+		require.NoError(t, err, debug)
+
+		require.Len(t, report.Warnings, 1)
+		assert.Equal(t, "style issue", report.Warnings[0].Message)
+		assert.Equal(t, "noisy", report.Warnings[0].RuleName)
+
+		if debug {
+			assert.Contains(t, out, logPrefix+" noisy stderr: checking style\n")
+			assert.Contains(t, out, logPrefix+" noisy stderr: checked style\n")
+		} else {
+			assert.NotContains(t, out, "checking style")
+		}
+	}
+}
+
+func TestRunPluginsInvalidOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("native test plugins are shell scripts")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	path := filepath.Join(dir, pluginPrefix+"broken")
+	writeTestFile(t, path, `#!/bin/sh
+cat > /dev/null
+echo "checking style"
+echo "failed to check style" >&2
+`, 0755)
+
+	// output which cannot be decoded is an error naming the plugin, along
+	// with what it wrote
+	report, err := runPlugins(
+		context.Background(), extend.ModeStatus, "broken", &protolock.Report{},
+		&projectConfig{}, filepath.Join(dir, "plugins"), time.Minute, false,
+	)
+	assert.Nil(t, report)
+	assert.ErrorContains(t, err, "broken ("+path+"): plugin data decode error")
+	assert.ErrorContains(t, err, "failed to check style")
+}
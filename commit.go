@@ -1,20 +1,29 @@
 package protolock
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"io"
-	"os"
 )
 
+// ErrLockNotFound indicates that no proto.lock file exists, and one must first
+// be created using Init.
+var ErrLockNotFound = errors.New(`no "proto.lock" file found, first run "init"`)
+
 // Commit will return an io.Reader with the lock representation data for caller to
-// use as needed.
+// use as needed. ErrLockNotFound is returned if there is no proto.lock file.
 func Commit(cfg Config) (io.Reader, error) {
+	return CommitContext(context.Background(), cfg)
+}
+
+// CommitContext is like Commit, but stops parsing proto files and returns the
+// context's error if ctx is done.
+func CommitContext(ctx context.Context, cfg Config) (io.Reader, error) {
 	if !cfg.LockFileExists() {
-		fmt.Println(`no "proto.lock" file found, first run "init"`)
-		os.Exit(1)
+		return nil, ErrLockNotFound
 	}
 
-	updated, err := getUpdatedLock(cfg)
+	updated, err := getUpdatedLock(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,69 @@
+package protolock
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockErrors(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(
+		filepath.Join(dir, "test.proto"), []byte(simpleProto), 0644,
+	)
+	assert.NoError(t, err)
+
+	cfg, err := NewConfig(dir, dir, ignoreArg, false, false)
+	assert.NoError(t, err)
+
+	_, err = Commit(*cfg)
+	assert.Equal(t, ErrLockNotFound, err)
+
+	_, err = Status(*cfg)
+	assert.Equal(t, ErrLockNotFound, err)
+
+	err = os.WriteFile(cfg.LockFilePath(), []byte("{}"), 0644)
+	assert.NoError(t, err)
+
+	_, err = Init(*cfg)
+	assert.Equal(t, ErrLockExists, err)
+}
+
+func TestContextCanceled(t *testing.T) {
+	cfg, err := NewConfig(".", ".", ignoreArg, false, false)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = CommitContext(ctx, *cfg)
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = StatusContext(ctx, *cfg)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestSetLogger(t *testing.T) {
+	defer SetLogger(nil)
+	defer SetDebug(false)
+
+	buf := &bytes.Buffer{}
+	SetLogger(log.New(buf, "", 0))
+	SetDebug(true)
+
+	curLock := parseTestProto(t, simpleProto)
+	_, err := Compare(curLock, curLock)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "RUN RULE: NoUsingReservedFields")
+
+	buf.Reset()
+	SetLogger(nil)
+	_, err = Compare(curLock, curLock)
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
@@ -1,7 +1,7 @@
 package protolock
 
 import (
-	"os"
+	"io/fs"
 	"path/filepath"
 )
 
@@ -11,6 +11,19 @@ type Config struct {
 	Ignore    string
 	UpToDate  bool
 	Debug     bool
+	// ProtoFS is the file system proto files are read from. When nil, the
+	// files are read from the ProtoRoot directory on disk. Lock files are
+	// always read from and written to the LockDir on disk.
+	ProtoFS fs.FS
+	// Engine compares the current and updated Protolocks in Status. When nil,
+	// Compare is used.
+	Engine *Engine
+	// Layout selects how the Protolock is stored in proto.lock files, see
+	// LockLayout.
+	Layout LockLayout
+	// Roots are proto roots in addition to the ProtoRoot, which are either
+	// locked along with it, or only used to resolve imported types.
+	Roots []Root
 }
 
 func NewConfig(
@@ -34,9 +47,11 @@ func NewConfig(
 	}, nil
 }
 
+// LockFileExists reports whether the proto.lock file, or any shard of a
+// sharded Layout, exists.
 func (cfg *Config) LockFileExists() bool {
-	_, err := os.Stat(cfg.LockFilePath())
-	return err == nil && !os.IsNotExist(err)
+	paths, err := cfg.lockFilePaths()
+	return err == nil && len(paths) != 0
 }
 
 func (cfg *Config) LockFilePath() string {
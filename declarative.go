@@ -0,0 +1,439 @@
+package protolock
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Scope is the kind of Protolock entity a declarative rule checks.
+type Scope string
+
+const (
+	ScopeFile      Scope = "file"
+	ScopeMessage   Scope = "message"
+	ScopeField     Scope = "field"
+	ScopeEnum      Scope = "enum"
+	ScopeEnumValue Scope = "enum_value"
+	ScopeService   Scope = "service"
+	ScopeRPC       Scope = "rpc"
+)
+
+// Event selects which entities a declarative rule checks.
+type Event string
+
+const (
+	// EventUpdated checks every entity in the updated Protolock, and is the
+	// default.
+	EventUpdated Event = "updated"
+	// EventAdded checks entities in the updated Protolock which are not in
+	// the current Protolock.
+	EventAdded Event = "added"
+	// EventRemoved checks entities in the current Protolock which are not in
+	// the updated Protolock.
+	EventRemoved Event = "removed"
+	// EventChanged checks entities in the updated Protolock whose attributes
+	// differ from those of the same entity in the current Protolock, which
+	// are available with the "previous_" prefix, e.g. "previous_required".
+	EventChanged Event = "changed"
+)
+
+// previousPrefix prefixes the attributes of the current entity checked by an
+// EventChanged rule.
+const previousPrefix = "previous_"
+
+// RuleDefinition declares a rule using expressions over the attributes of
+// Protolock entities, rather than a RuleFunc. For each entity of the Scope
+// selected by the Event and matching the Where expression, a Warning is
+// returned if the Require expression is false. Without a Require expression,
+// every matching entity results in a Warning. Expressions using attributes
+// unknown to the Scope are rejected by Rule. An expression which cannot be
+// evaluated for an entity, e.g. one comparing a string using "<", results in
+// a Warning for that entity, and the remaining entities are still checked.
+//
+// Entities in every scope have the "file" and "package" attributes, and:
+//
+//	file:        name
+//	message:     name
+//	field:       name, message, type, id, repeated, optional, required,
+//	             oneof, map, key_type
+//	enum:        name
+//	enum_value:  name, enum, number
+//	service:     name
+//	rpc:         name, service, in_type, out_type, client_streaming,
+//	             server_streaming
+//
+// Message names include the names of any parent messages, e.g. "Outer.Inner".
+// Rules for EventChanged can also use the attributes of the current entity,
+// e.g. "required && !previous_required" matches fields which became required.
+type RuleDefinition struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Scope       Scope    `json:"scope"`
+	Event       Event    `json:"event,omitempty"`
+	Where       string   `json:"where,omitempty"`
+	Require     string   `json:"require,omitempty"`
+	Severity    Severity `json:"severity,omitempty"`
+	// Message is the warning message, in which attribute names surrounded by
+	// braces are replaced by their values, e.g. "{message}.{name}". It
+	// defaults to the Description.
+	Message  string    `json:"message,omitempty"`
+	Profiles []Profile `json:"profiles,omitempty"`
+}
+
+// Rule compiles the RuleDefinition into a Rule, which may be registered using
+// RegisterRule.
+func (d RuleDefinition) Rule() (Rule, error) {
+	if d.Name == "" {
+		return Rule{}, fmt.Errorf("%w: rule name is required", ErrInvalidRule)
+	}
+
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf(
+			"%w: %q: %s", ErrInvalidRule, d.Name, fmt.Sprintf(format, args...),
+		)
+	}
+
+	if _, ok := entityKeys[d.Scope]; !ok {
+		return Rule{}, invalid("unknown scope %q", d.Scope)
+	}
+
+	event := d.Event
+	switch event {
+	case "":
+		event = EventUpdated
+	case EventUpdated, EventAdded, EventRemoved, EventChanged:
+	default:
+		return Rule{}, invalid("unknown event %q", d.Event)
+	}
+
+	switch d.Severity {
+	case "", SeverityError, SeverityWarning, SeverityInfo:
+	default:
+		return Rule{}, invalid("unknown severity %q", d.Severity)
+	}
+
+	for _, p := range d.Profiles {
+		if _, err := ParseProfile(string(p)); err != nil {
+			return Rule{}, invalid("%v", err)
+		}
+	}
+
+	where, require := expr(literalExpr{true}), expr(literalExpr{false})
+	var err error
+	if d.Where != "" {
+		if where, err = compileExpr(d.Where); err != nil {
+			return Rule{}, invalid("where: %v", err)
+		}
+		if name, ok := unknownAttr(where, d.Scope, event); ok {
+			return Rule{}, invalid("where: unknown %s attribute %q", d.Scope, name)
+		}
+	}
+	if d.Require != "" {
+		if require, err = compileExpr(d.Require); err != nil {
+			return Rule{}, invalid("require: %v", err)
+		}
+		if name, ok := unknownAttr(require, d.Scope, event); ok {
+			return Rule{}, invalid("require: unknown %s attribute %q", d.Scope, name)
+		}
+	}
+
+	message := d.Message
+	if message == "" {
+		message = d.Description
+	}
+	if message == "" {
+		message = fmt.Sprintf("violates rule %s", d.Name)
+	}
+
+	check := func(current, updated *Index) ([]Warning, bool) {
+		var warnings []Warning
+		for _, e := range selectEntities(d.Scope, event, current.Lock(), updated.Lock()) {
+			warning := Warning{
+				Filepath:   OSPath(Protopath(e.attrs["file"].(string))),
+				EntityPath: e.path,
+				Severity:   d.Severity,
+			}
+
+			ok, err := evalBool(where, e.attrs)
+			if err == nil && ok {
+				ok, err = evalBool(require, e.attrs)
+				ok = !ok
+			}
+			if err != nil {
+				warning.Message = fmt.Sprintf("rule %s failed: %v", d.Name, err)
+				warnings = append(warnings, warning)
+				continue
+			}
+			if !ok {
+				continue
+			}
+
+			warning.Message = expandMessage(message, e.attrs)
+			warnings = append(warnings, warning)
+		}
+
+		if warnings != nil {
+			return warnings, false
+		}
+		return nil, true
+	}
+
+	return Rule{
+		Name:        d.Name,
+		Description: d.Description,
+		Func:        WithIndex(check),
+		IndexFunc:   check,
+		Profiles:    d.Profiles,
+	}, nil
+}
+
+// expandMessage replaces attribute names in braces within msg by their values.
+func expandMessage(msg string, attrs map[string]interface{}) string {
+	var pairs []string
+	for name, v := range attrs {
+		pairs = append(pairs, "{"+name+"}", fmt.Sprint(v))
+	}
+	return strings.NewReplacer(pairs...).Replace(msg)
+}
+
+// entity is a Protolock entity with the attributes available to rule
+// expressions, and its fully-qualified path.
+type entity struct {
+	path  string
+	attrs map[string]interface{}
+}
+
+// entityKeys maps each Scope to the attributes which identify an entity within
+// a file, used to find added and removed entities.
+var entityKeys = map[Scope][]string{
+	ScopeFile:      {},
+	ScopeMessage:   {"name"},
+	ScopeField:     {"message", "name"},
+	ScopeEnum:      {"name"},
+	ScopeEnumValue: {"enum", "name"},
+	ScopeService:   {"name"},
+	ScopeRPC:       {"service", "name"},
+}
+
+// scopeAttrs maps each Scope to the attributes of its entities, in addition to
+// "file" and "package", which must match the attributes set by getEntities.
+var scopeAttrs = map[Scope][]string{
+	ScopeFile:    {"name"},
+	ScopeMessage: {"name"},
+	ScopeField: {
+		"name", "message", "type", "id", "repeated", "optional", "required",
+		"oneof", "map", "key_type",
+	},
+	ScopeEnum:      {"name"},
+	ScopeEnumValue: {"name", "enum", "number"},
+	ScopeService:   {"name"},
+	ScopeRPC: {
+		"name", "service", "in_type", "out_type", "client_streaming",
+		"server_streaming",
+	},
+}
+
+// unknownAttr returns the first attribute used by e which entities of the
+// scope do not have. Attributes of the current entity, with the
+// previousPrefix, are only known to EventChanged rules.
+func unknownAttr(e expr, scope Scope, event Event) (string, bool) {
+	for _, name := range exprAttrs(e) {
+		attr := name
+		if event == EventChanged {
+			attr = strings.TrimPrefix(name, previousPrefix)
+		}
+		if attr != "file" && attr != "package" &&
+			!containsString(scopeAttrs[scope], attr) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// entityKey returns the key identifying e among entities of the scope.
+func entityKey(scope Scope, e entity) string {
+	key := []string{fmt.Sprint(e.attrs["file"])}
+	for _, attr := range entityKeys[scope] {
+		key = append(key, fmt.Sprint(e.attrs[attr]))
+	}
+	return strings.Join(key, ":")
+}
+
+// selectEntities returns the entities of the scope checked for the event.
+func selectEntities(scope Scope, event Event, current, updated Protolock) []entity {
+	switch event {
+	case EventAdded:
+		return entityDifference(scope, updated, current)
+	case EventRemoved:
+		return entityDifference(scope, current, updated)
+	case EventChanged:
+		return changedEntities(scope, current, updated)
+	default:
+		return getEntities(scope, updated)
+	}
+}
+
+// entityDifference returns the entities of the scope in a which are not in b.
+func entityDifference(scope Scope, a, b Protolock) []entity {
+	inB := make(map[string]bool)
+	for _, e := range getEntities(scope, b) {
+		inB[entityKey(scope, e)] = true
+	}
+
+	var diff []entity
+	for _, e := range getEntities(scope, a) {
+		if !inB[entityKey(scope, e)] {
+			diff = append(diff, e)
+		}
+	}
+	return diff
+}
+
+// changedEntities returns the entities of the scope in updated whose
+// attributes differ from those of the same entity in current, which are added
+// to their attributes with the previousPrefix.
+func changedEntities(scope Scope, current, updated Protolock) []entity {
+	previous := make(map[string]entity)
+	for _, e := range getEntities(scope, current) {
+		previous[entityKey(scope, e)] = e
+	}
+
+	var changed []entity
+	for _, e := range getEntities(scope, updated) {
+		prev, ok := previous[entityKey(scope, e)]
+		if !ok || equalAttrs(prev.attrs, e.attrs) {
+			continue
+		}
+
+		for name, v := range prev.attrs {
+			e.attrs[previousPrefix+name] = v
+		}
+		changed = append(changed, e)
+	}
+	return changed
+}
+
+// equalAttrs reports whether a and b have the same attributes and values.
+func equalAttrs(a, b map[string]interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, v := range a {
+		if bv, ok := b[name]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// getEntities returns all entities of the scope in the Protolock, ordered by
+// file path.
+func getEntities(scope Scope, lock Protolock) []entity {
+	defs := append([]Definition(nil), lock.Definitions...)
+	sort.SliceStable(defs, func(i, j int) bool {
+		return defs[i].Filepath < defs[j].Filepath
+	})
+
+	var entities []entity
+	for _, def := range defs {
+		pkg := def.Def.Package.Name
+		add := func(name string, attrs map[string]interface{}) {
+			attrs["file"] = string(def.Filepath)
+			attrs["package"] = pkg
+			path := name
+			if pkg != "" && name != "" {
+				path = pkg + nestedPrefix + name
+			}
+			entities = append(entities, entity{path: path, attrs: attrs})
+		}
+
+		switch scope {
+		case ScopeFile:
+			add("", map[string]interface{}{"name": string(def.Filepath)})
+
+		case ScopeMessage, ScopeField:
+			for _, msg := range def.Def.Messages {
+				addMessageEntities(scope, "", msg, add)
+			}
+
+		case ScopeEnum, ScopeEnumValue:
+			for _, enum := range def.Def.Enums {
+				if scope == ScopeEnum {
+					add(enum.Name, map[string]interface{}{"name": enum.Name})
+					continue
+				}
+				for _, f := range enum.EnumFields {
+					add(enum.Name+nestedPrefix+f.Name, map[string]interface{}{
+						"name":   f.Name,
+						"enum":   enum.Name,
+						"number": f.Integer,
+					})
+				}
+			}
+
+		case ScopeService, ScopeRPC:
+			for _, svc := range def.Def.Services {
+				if scope == ScopeService {
+					add(svc.Name, map[string]interface{}{"name": svc.Name})
+					continue
+				}
+				for _, rpc := range svc.RPCs {
+					add(svc.Name+nestedPrefix+rpc.Name, map[string]interface{}{
+						"name":             rpc.Name,
+						"service":          svc.Name,
+						"in_type":          rpc.InType,
+						"out_type":         rpc.OutType,
+						"client_streaming": rpc.InStreamed,
+						"server_streaming": rpc.OutStreamed,
+					})
+				}
+			}
+		}
+	}
+
+	return entities
+}
+
+// addMessageEntities adds msg and its nested messages, or their fields,
+// depending on the scope.
+func addMessageEntities(
+	scope Scope,
+	prefix string,
+	msg Message,
+	add func(string, map[string]interface{}),
+) {
+	name := prefix + msg.Name
+	if scope == ScopeMessage {
+		add(name, map[string]interface{}{"name": name})
+	} else {
+		addField := func(f Field, isMap bool, keyType string) {
+			typ := f.Type
+			if isMap {
+				typ = fmt.Sprintf("map<%s, %s>", keyType, f.Type)
+			}
+			add(name+nestedPrefix+f.Name, map[string]interface{}{
+				"name":     f.Name,
+				"message":  name,
+				"type":     typ,
+				"id":       f.ID,
+				"repeated": f.IsRepeated,
+				"optional": f.IsOptional,
+				"required": f.IsRequired,
+				"oneof":    f.OneofParent,
+				"map":      isMap,
+				"key_type": keyType,
+			})
+		}
+		for _, f := range msg.Fields {
+			addField(f, false, "")
+		}
+		for _, m := range msg.Maps {
+			addField(m.Field, true, m.KeyType)
+		}
+	}
+
+	for _, nested := range msg.Messages {
+		addMessageEntities(scope, name+nestedPrefix, nested, add)
+	}
+}
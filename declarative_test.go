@@ -0,0 +1,251 @@
+package protolock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const declarativeCurrentProto = `syntax = "proto2";
+
+package test.v1;
+
+message GetChannelRequest {
+	optional string name = 1;
+}
+
+message Channel {
+	optional int64 id = 1;
+	optional string channel_name = 2;
+	optional string owner = 3;
+}
+
+service ChannelService {
+	rpc GetChannel (GetChannelRequest) returns (Channel);
+	rpc ListChannels (GetChannelRequest) returns (Channel);
+}
+`
+
+const declarativeUpdatedProto = `syntax = "proto2";
+
+package test.v1;
+
+message GetChannelRequest {
+	optional string name = 1;
+	required string parent = 2;
+}
+
+message Channel {
+	optional int64 id = 1;
+	optional string channelName = 2;
+	required string owner = 3;
+}
+
+service ChannelService {
+	rpc GetChannel (GetChannelRequest) returns (Channel);
+}
+`
+
+func TestCompileExpr(t *testing.T) {
+	attrs := map[string]interface{}{
+		"name":     "channel_name",
+		"id":       2,
+		"required": false,
+		"número":   2,
+	}
+
+	for src, want := range map[string]bool{
+		`name == "channel_name"`:                    true,
+		`name != 'channel_name'`:                    false,
+		`name =~ "^[a-z][a-z0-9_]*$"`:               true,
+		`name !~ "_"`:                               false,
+		`id >= 2 && id < 10`:                        true,
+		`required || id > 2`:                        false,
+		`!required && (id == 1 || id == 2)`:         true,
+		`!(name =~ "name$") || required`:            false,
+		`name == "other" || name == "channel_name"`: true,
+		`name != "kanał" && name !~ "^ñ"`:           true,
+		`número == 2`:                               true,
+	} {
+		e, err := compileExpr(src)
+		if !assert.NoError(t, err, src) {
+			continue
+		}
+		got, err := evalBool(e, attrs)
+		assert.NoError(t, err, src)
+		assert.Equal(t, want, got, src)
+	}
+
+	for _, src := range []string{
+		`name ==`,
+		`(name == "a"`,
+		`name =~ id`,
+		`name =~ "("`,
+		`name == "a`,
+		`name # 1`,
+		`name == 1 ٣`,
+	} {
+		_, err := compileExpr(src)
+		assert.ErrorIs(t, err, ErrInvalidExpression, src)
+	}
+
+	e, err := compileExpr(`unknown == 1`)
+	assert.NoError(t, err)
+	_, err = evalBool(e, attrs)
+	assert.ErrorIs(t, err, ErrInvalidExpression)
+}
+
+func TestRuleDefinition(t *testing.T) {
+	curLock := parseTestProto(t, declarativeCurrentProto)
+	updLock := parseTestProto(t, declarativeUpdatedProto)
+
+	snakeCase, err := RuleDefinition{
+		Name:     "FieldNamesSnakeCase",
+		Scope:    ScopeField,
+		Require:  `name =~ "^[a-z][a-z0-9_]*$"`,
+		Severity: SeverityWarning,
+		Message:  `"{message}" field: "{name}" must be snake_case`,
+	}.Rule()
+	assert.NoError(t, err)
+
+	warnings, ok := snakeCase.Func(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, `"Channel" field: "channelName" must be snake_case`, warnings[0].Message)
+	assert.Equal(t, "test.v1.Channel.channelName", warnings[0].EntityPath)
+	assert.Equal(t, SeverityWarning, warnings[0].Severity)
+
+	noRemovingRPCs, err := RuleDefinition{
+		Name:        "NoRemovingV1RPCs",
+		Description: "RPCs in v1 packages must not be removed.",
+		Scope:       ScopeRPC,
+		Event:       EventRemoved,
+		Where:       `package =~ "\.v1$"`,
+	}.Rule()
+	assert.NoError(t, err)
+
+	warnings, ok = noRemovingRPCs.Func(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, "RPCs in v1 packages must not be removed.", warnings[0].Message)
+	assert.Equal(t, "test.v1.ChannelService.ListChannels", warnings[0].EntityPath)
+
+	noRequiredFields, err := RuleDefinition{
+		Name:    "NoAddingRequiredFieldsToRequests",
+		Scope:   ScopeField,
+		Event:   EventAdded,
+		Where:   `message =~ "Request$"`,
+		Require: `!required`,
+		Message: `"{message}" field: "{name}" must not be required`,
+	}.Rule()
+	assert.NoError(t, err)
+
+	warnings, ok = noRequiredFields.Func(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, `"GetChannelRequest" field: "parent" must not be required`, warnings[0].Message)
+
+	_, ok = noRequiredFields.Func(curLock, curLock)
+	assert.True(t, ok)
+
+	becameRequired, err := RuleDefinition{
+		Name:    "NoMakingFieldsRequired",
+		Scope:   ScopeField,
+		Event:   EventChanged,
+		Where:   `required && !previous_required`,
+		Message: `"{message}" field: "{name}" must not become required`,
+	}.Rule()
+	assert.NoError(t, err)
+
+	// the renamed "channelName" field is not the same entity, and "parent"
+	// was added rather than changed
+	warnings, ok = becameRequired.Func(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, `"Channel" field: "owner" must not become required`, warnings[0].Message)
+	assert.Equal(t, "test.v1.Channel.owner", warnings[0].EntityPath)
+
+	_, ok = becameRequired.Func(updLock, updLock)
+	assert.True(t, ok)
+
+	// an expression which cannot be evaluated is reported for each entity,
+	// rather than stopping the rule
+	badComparison, err := RuleDefinition{
+		Name:  "BadComparison",
+		Scope: ScopeRPC,
+		Where: `name == "GetChannel" || name > 1`,
+	}.Rule()
+	assert.NoError(t, err)
+
+	warnings, ok = badComparison.Func(curLock, curLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 2)
+	assert.Equal(t, "violates rule BadComparison", warnings[0].Message)
+	assert.Equal(t, "test.v1.ChannelService.GetChannel", warnings[0].EntityPath)
+	assert.Contains(t, warnings[1].Message, `rule BadComparison failed`)
+	assert.Equal(t, "test.v1.ChannelService.ListChannels", warnings[1].EntityPath)
+
+	// unknown attributes are rejected once, even if no entity is checked
+	_, err = RuleDefinition{
+		Name:  "UnknownAttribute",
+		Scope: ScopeRPC,
+		Where: `name == "GetChannel" || unknown`,
+	}.Rule()
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.ErrorContains(t, err, `"UnknownAttribute": where: unknown rpc attribute "unknown"`)
+
+	for _, def := range []RuleDefinition{
+		{Scope: ScopeField},
+		{Name: "BadScope", Scope: "oneof"},
+		{Name: "BadEvent", Scope: ScopeField, Event: "renamed"},
+		{Name: "BadSeverity", Scope: ScopeField, Severity: "fatal"},
+		{Name: "BadProfile", Scope: ScopeField, Profiles: []Profile{"binary"}},
+		{Name: "BadWhere", Scope: ScopeField, Where: `name ==`},
+		{Name: "BadRequire", Scope: ScopeField, Require: `(`},
+		{Name: "TypoWhere", Scope: ScopeField, Where: `nmae == "id"`},
+		{Name: "TypoRequire", Scope: ScopeEnumValue, Require: `!(number < 0) && !reqired`},
+		{Name: "WrongScope", Scope: ScopeMessage, Require: `type != "bytes"`},
+		{Name: "PreviousUnlessChanged", Scope: ScopeField, Where: `previous_required`},
+		{Name: "UnknownPrevious", Scope: ScopeField, Event: EventChanged, Where: `previous_nmae != name`},
+	} {
+		_, err := def.Rule()
+		assert.ErrorIs(t, err, ErrInvalidRule, def.Name)
+	}
+}
+
+func TestScopeAttrs(t *testing.T) {
+	lock := parseTestProto(t, `syntax = "proto3";
+package test;
+
+message Channel {
+  int64 id = 1;
+  map<string, string> labels = 2;
+}
+
+enum Status {
+  UNKNOWN = 0;
+}
+
+service ChannelService {
+  rpc GetChannel (Channel) returns (Channel);
+}
+`)
+
+	// the attributes known to each scope are those of its entities
+	for scope, attrs := range scopeAttrs {
+		entities := getEntities(scope, lock)
+		if !assert.NotEmpty(t, entities, scope) {
+			continue
+		}
+		for _, e := range entities {
+			var names []string
+			for name := range e.attrs {
+				if name != "file" && name != "package" {
+					names = append(names, name)
+				}
+			}
+			assert.ElementsMatch(t, attrs, names, scope)
+		}
+	}
+	assert.Len(t, scopeAttrs, len(entityKeys))
+}
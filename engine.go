@@ -0,0 +1,157 @@
+package protolock
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Engine compares Protolocks using its own set of rules and settings. Compare
+// and the exported RuleFuncs use the settings of a default Engine, which are
+// set using SetStrict, SetDebug, SetProfile and SetSensitiveOptions, while
+// Engines with different settings can be used concurrently.
+type Engine struct {
+	// Rules are run by Compare.
+	Rules []Rule
+	// Strict enables the rules which are only enforced in strict mode.
+	Strict bool
+	// Profile selects the compatibility profile to enforce. Only rules which
+	// protect the Profile are run, and the empty Profile runs all rules.
+	Profile Profile
+	// SensitiveOptions lists the option names checked by the
+	// NoChangingSensitiveOptions rule, and defaults to DefaultSensitiveOptions
+	// when empty.
+	SensitiveOptions []string
+	// Debug receives the output of each rule when not nil.
+	Debug io.Writer
+	// Includes holds the definitions of include-only proto roots, which are
+	// not compared, but are indexed to resolve the types they define.
+	Includes Protolock
+}
+
+// EngineOptions configures an Engine returned by NewEngine.
+type EngineOptions struct {
+	Strict  bool
+	Profile Profile
+	// SensitiveOptions lists the option names which must not change, and
+	// defaults to DefaultSensitiveOptions.
+	SensitiveOptions []string
+	Debug            io.Writer
+}
+
+// NewEngine returns an Engine running the built-in rules, configured by opts.
+func NewEngine(opts EngineOptions) *Engine {
+	return &Engine{
+		Rules:            BuiltinRules(),
+		Strict:           opts.Strict,
+		Profile:          opts.Profile,
+		SensitiveOptions: trimNames(opts.SensitiveOptions),
+		Debug:            opts.Debug,
+	}
+}
+
+// BuiltinRules returns a copy of the rules built in to protolock. Rules which
+// depend on the settings of an Engine, such as NoChangingSensitiveOptions,
+// use those of the Engine which runs them, and those of the default Engine
+// when their Func or IndexFunc is called directly.
+func BuiltinRules() []Rule {
+	return append([]Rule(nil), builtinRules...)
+}
+
+// RegisterRule adds a Rule to the Rules run by the Engine, see RegisterRule.
+func (e *Engine) RegisterRule(rule Rule) error {
+	return registerRule(&e.Rules, rule)
+}
+
+// SetSensitiveOptions replaces the list of option names checked by the
+// NoChangingSensitiveOptions rule of the Engine. An empty list restores the
+// defaults.
+func (e *Engine) SetSensitiveOptions(names []string) {
+	e.SensitiveOptions = trimNames(names)
+}
+
+// std holds the settings of the default Engine, which are set using
+// SetStrict, SetDebug, SetProfile and SetSensitiveOptions.
+var std = &Engine{Strict: true}
+
+// defaultEngine returns the default Engine used by Compare, which runs the
+// Rules using the settings of std.
+func defaultEngine() *Engine {
+	e := *std
+	e.Rules = Rules
+	return &e
+}
+
+// Compare returns a Report struct and an error which indicates that there is
+// one or more warnings to report to the caller. If no error is returned, the
+// Report can be ignored. Rules are run concurrently, and the warnings are
+// ordered by rule, then by path and message.
+func (e *Engine) Compare(current, update Protolock) (*Report, error) {
+	report := &Report{
+		Current: current,
+		Updated: update,
+	}
+
+	// each Protolock is indexed once, and its Index shared by all rules
+	cur, upd := NewIndex(current, e.Includes), NewIndex(update, e.Includes)
+
+	var rules []Rule
+	for _, rule := range e.Rules {
+		if !rule.Protects(e.Profile) || (rule.Strict && !e.Strict) {
+			continue
+		}
+		if rule.engineFunc != nil {
+			rule.IndexFunc = rule.engineFunc(e)
+		}
+		rules = append(rules, rule)
+	}
+
+	// each rule writes its warnings to its own index, so that the results
+	// are collected without locking and in a deterministic order
+	results := make([][]Warning, len(rules))
+	var wg sync.WaitGroup
+	for i, rule := range rules {
+		wg.Add(1)
+		go func(i int, rule Rule) {
+			defer wg.Done()
+
+			var warnings []Warning
+			if rule.IndexFunc != nil {
+				warnings, _ = rule.IndexFunc(cur, upd)
+			} else {
+				warnings, _ = rule.Func(current, update)
+			}
+			for j := range warnings {
+				warnings[j].RuleName = rule.Name
+			}
+			orderByPathAndMessage(warnings)
+			results[i] = warnings
+		}(i, rule)
+	}
+	wg.Wait()
+
+	for i, rule := range rules {
+		if e.Debug != nil {
+			debugRule(e.Debug, rule.Name, results[i])
+		}
+		report.Warnings = append(report.Warnings, results[i]...)
+	}
+
+	if len(report.Warnings) != 0 {
+		return report, ErrWarningsFound
+	}
+
+	return report, nil
+}
+
+// debugRule writes the warnings returned by a rule to w. It is called once all
+// rules have run, so that the output of concurrent rules is not interleaved.
+func debugRule(w io.Writer, name string, warnings []Warning) {
+	fmt.Fprintln(w, "RUN RULE:", name)
+	fmt.Fprintln(w, "# Warnings:", len(warnings))
+	for i, warning := range warnings {
+		fmt.Fprintf(w, "%d). %s [%s]\n", i+1, warning.Message, warning.Filepath)
+	}
+	fmt.Fprintln(w, "END RULE:", name)
+	fmt.Fprintln(w, "===")
+}
@@ -0,0 +1,146 @@
+package protolock
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func countRule(warnings []Warning, name string) int {
+	var n int
+	for _, w := range warnings {
+		if w.RuleName == name {
+			n++
+		}
+	}
+	return n
+}
+
+func TestEngineCompare(t *testing.T) {
+	curLock := parseTestProto(t, noChangingEnumAliasesProto)
+	updLock := parseTestProto(t, changingEnumAliasesProto)
+
+	strictEngine := NewEngine(EngineOptions{Strict: true})
+	looseEngine := NewEngine(EngineOptions{Strict: false})
+
+	// engines with different settings can be used concurrently
+	var wg sync.WaitGroup
+	var strictReport, looseReport *Report
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		strictReport, _ = strictEngine.Compare(curLock, updLock)
+	}()
+	go func() {
+		defer wg.Done()
+		looseReport, _ = looseEngine.Compare(curLock, updLock)
+	}()
+	wg.Wait()
+
+	assert.Equal(t, 2, countRule(strictReport.Warnings, "NoChangingEnumAliases"))
+	assert.Equal(t, 0, countRule(looseReport.Warnings, "NoChangingEnumAliases"))
+	assert.Equal(t, 1, countRule(looseReport.Warnings, "NoRemovingEnumAllowAlias"))
+}
+
+func TestEngineSensitiveOptions(t *testing.T) {
+	curLock := parseTestProto(t, noChangingSensitiveOptionsProto)
+	updLock := parseTestProto(t, changingSensitiveOptionsProto)
+
+	report, err := NewEngine(EngineOptions{}).Compare(curLock, updLock)
+	assert.Equal(t, ErrWarningsFound, err)
+	assert.Equal(t, 5, countRule(report.Warnings, "NoChangingSensitiveOptions"))
+
+	report, err = NewEngine(EngineOptions{
+		SensitiveOptions: []string{"(kind_opt)", " (google.api.http)"},
+	}).Compare(curLock, updLock)
+	assert.Equal(t, ErrWarningsFound, err)
+	assert.Equal(t, 2, countRule(report.Warnings, "NoChangingSensitiveOptions"))
+
+	// the package-level settings are unaffected
+	warnings, _ := NoChangingSensitiveOptions(curLock, updLock)
+	assert.Len(t, warnings, 5)
+}
+
+func TestEngineDebugAndRegisterRule(t *testing.T) {
+	buf := &bytes.Buffer{}
+	engine := NewEngine(EngineOptions{Strict: true, Debug: buf})
+
+	rule := Rule{
+		Name: "AlwaysWarns",
+		Func: func(current, updated Protolock) ([]Warning, bool) {
+			return []Warning{{Message: "warned"}}, false
+		},
+	}
+	assert.NoError(t, engine.RegisterRule(rule))
+	assert.ErrorIs(t, engine.RegisterRule(rule), ErrInvalidRule)
+	assert.Len(t, Rules, len(builtinRules))
+
+	lock := parseTestProto(t, simpleProto)
+	report, err := engine.Compare(lock, lock)
+	assert.Equal(t, ErrWarningsFound, err)
+	assert.Equal(t, 1, countRule(report.Warnings, "AlwaysWarns"))
+	assert.Contains(t, buf.String(), "RUN RULE: AlwaysWarns")
+}
+
+func TestEngineCompareDeterministic(t *testing.T) {
+	curLock := parseTestProto(t, noChangingSensitiveOptionsProto)
+	updLock := parseTestProto(t, changingSensitiveOptionsProto)
+	engine := NewEngine(EngineOptions{Strict: true})
+
+	first, err := engine.Compare(curLock, updLock)
+	assert.Equal(t, ErrWarningsFound, err)
+
+	for i := 0; i < 20; i++ {
+		report, err := engine.Compare(curLock, updLock)
+		assert.Equal(t, ErrWarningsFound, err)
+		assert.Equal(t, first.Warnings, report.Warnings)
+	}
+
+	// warnings are grouped by rule, in the order the rules are listed
+	var ruleOrder []string
+	for _, w := range first.Warnings {
+		if len(ruleOrder) == 0 || ruleOrder[len(ruleOrder)-1] != w.RuleName {
+			ruleOrder = append(ruleOrder, w.RuleName)
+		}
+	}
+	var listed []string
+	for _, rule := range engine.Rules {
+		if countRule(first.Warnings, rule.Name) > 0 {
+			listed = append(listed, rule.Name)
+		}
+	}
+	assert.Equal(t, listed, ruleOrder)
+}
+
+func TestDefaultEngineSettings(t *testing.T) {
+	defer SetStrict(true)
+	defer SetProfile("")
+	defer SetSensitiveOptions(nil)
+
+	curLock := parseTestProto(t, noChangingSensitiveOptionsProto)
+	updLock := parseTestProto(t, changingSensitiveOptionsProto)
+
+	SetStrict(false)
+	SetProfile(ProfileWire)
+	SetSensitiveOptions([]string{"(kind_opt)"})
+
+	e := defaultEngine()
+	assert.False(t, e.Strict)
+	assert.Equal(t, ProfileWire, e.Profile)
+	assert.Equal(t, []string{"(kind_opt)"}, e.SensitiveOptions)
+
+	// the exported rule funcs use the settings of the default Engine
+	warnings, _ := NoChangingSensitiveOptions(curLock, updLock)
+	assert.Len(t, warnings, 1)
+
+	// while other Engines are unaffected by them
+	report, _ := NewEngine(EngineOptions{}).Compare(curLock, updLock)
+	assert.Equal(t, 5, countRule(report.Warnings, "NoChangingSensitiveOptions"))
+
+	// and the default Engine is a copy, whose settings are unaffected by
+	// later changes
+	SetStrict(true)
+	assert.False(t, e.Strict)
+}
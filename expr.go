@@ -0,0 +1,419 @@
+package protolock
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidExpression indicates that a rule expression cannot be parsed.
+var ErrInvalidExpression = errors.New("invalid expression")
+
+// expr is a compiled rule expression, evaluated against the attributes of a
+// Protolock entity. The expression language supports:
+//
+//	attributes:   name, type, id, required, ...
+//	literals:     "text", 'text', 42, true, false
+//	comparisons:  ==, !=, <, <=, >, >=
+//	regexps:      name =~ "^[a-z_]+$", name !~ "Request$"
+//	logic:        !, &&, || and parentheses
+type expr interface {
+	eval(attrs map[string]interface{}) (interface{}, error)
+}
+
+// compileExpr parses src into an expr.
+func compileExpr(src string) (expr, error) {
+	p := &exprParser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return e, nil
+}
+
+// evalBool evaluates e, which must result in a bool.
+func evalBool(e expr, attrs map[string]interface{}) (bool, error) {
+	v, err := e.eval(attrs)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: expected bool result, got %v", ErrInvalidExpression, v)
+	}
+	return b, nil
+}
+
+// exprAttrs returns the names of the attributes used by e, in order.
+func exprAttrs(e expr) []string {
+	switch e := e.(type) {
+	case attrExpr:
+		return []string{e.name}
+	case notExpr:
+		return exprAttrs(e.operand)
+	case logicExpr:
+		return append(exprAttrs(e.left), exprAttrs(e.right)...)
+	case compareExpr:
+		return append(exprAttrs(e.left), exprAttrs(e.right)...)
+	case matchExpr:
+		return exprAttrs(e.operand)
+	default:
+		return nil
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+type exprParser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(
+		"%w: %s in %q", ErrInvalidExpression, fmt.Sprintf(format, args...), p.src,
+	)
+}
+
+var exprOperators = []string{
+	"&&", "||", "==", "!=", "=~", "!~", "<=", ">=", "<", ">", "!", "(", ")",
+}
+
+func (p *exprParser) tokenize() error {
+	src := p.src
+	for i := 0; i < len(src); {
+		c, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(src) && rune(src[j]) != c; j++ {
+				// only quotes and backslashes are escaped, so that regexps
+				// such as "\.v1$" need no further escaping. Quotes and
+				// backslashes never occur within a multi-byte UTF-8
+				// character, so the string is copied byte by byte.
+				if src[j] == '\\' && j+1 < len(src) &&
+					(rune(src[j+1]) == c || src[j+1] == '\\') {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return p.errorf("unterminated string")
+			}
+			p.tokens = append(p.tokens, token{tokenString, sb.String()})
+			i = j + 1
+
+		case isDigit(c) || c == '-':
+			j := i + size
+			for j < len(src) && isDigit(rune(src[j])) {
+				j++
+			}
+			p.tokens = append(p.tokens, token{tokenNumber, src[i:j]})
+			i = j
+
+		case unicode.IsLetter(c) || c == '_':
+			j := i + size
+			for j < len(src) {
+				r, n := utf8.DecodeRuneInString(src[j:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				j += n
+			}
+			p.tokens = append(p.tokens, token{tokenIdent, src[i:j]})
+			i = j
+
+		default:
+			var op string
+			for _, o := range exprOperators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return p.errorf("unexpected character %q", c)
+			}
+			p.tokens = append(p.tokens, token{tokenOperator, op})
+			i += len(op)
+		}
+	}
+
+	return nil
+}
+
+// isDigit reports whether c is an ASCII digit, which strconv.Atoi accepts.
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *exprParser) peek(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peek("||"); !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicExpr{op: "||", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peek("&&"); !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicExpr{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseNot() (expr, error) {
+	if _, ok := p.peek("!"); ok {
+		p.pos++
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := p.peek("==", "!=", "=~", "!~", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	p.pos++
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if op == "=~" || op == "!~" {
+		lit, ok := right.(literalExpr)
+		s, isString := lit.value.(string)
+		if !ok || !isString {
+			return nil, p.errorf("%s requires a string regexp", op)
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return matchExpr{negate: op == "!~", operand: left, re: re}, nil
+	}
+
+	return compareExpr{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseOperand() (expr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch tok.kind {
+	case tokenString:
+		return literalExpr{tok.text}, nil
+
+	case tokenNumber:
+		n, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		return literalExpr{n}, nil
+
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return literalExpr{true}, nil
+		case "false":
+			return literalExpr{false}, nil
+		}
+		return attrExpr{tok.text}, nil
+
+	default:
+		if tok.text != "(" {
+			return nil, p.errorf("unexpected %q", tok.text)
+		}
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.peek(")"); !ok {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return e, nil
+	}
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (e literalExpr) eval(map[string]interface{}) (interface{}, error) {
+	return e.value, nil
+}
+
+type attrExpr struct {
+	name string
+}
+
+func (e attrExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	v, ok := attrs[e.name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown attribute %q", ErrInvalidExpression, e.name)
+	}
+	return v, nil
+}
+
+type notExpr struct {
+	operand expr
+}
+
+func (e notExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	b, err := evalBool(e.operand, attrs)
+	return !b, err
+}
+
+type logicExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e logicExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	left, err := evalBool(e.left, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	// short-circuit evaluation
+	if (e.op == "&&" && !left) || (e.op == "||" && left) {
+		return left, nil
+	}
+
+	return evalBool(e.right, attrs)
+}
+
+type matchExpr struct {
+	negate  bool
+	operand expr
+	re      *regexp.Regexp
+}
+
+func (e matchExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	v, err := e.operand.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return e.re.MatchString(fmt.Sprint(v)) != e.negate, nil
+}
+
+type compareExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e compareExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	left, err := e.left.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	l, lok := left.(int)
+	r, rok := right.(int)
+	if !lok || !rok {
+		return nil, fmt.Errorf(
+			"%w: %s requires numbers, got %v and %v",
+			ErrInvalidExpression, e.op, left, right,
+		)
+	}
+
+	switch e.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	default:
+		return l >= r, nil
+	}
+}
@@ -1,6 +1,7 @@
 package extend
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/nilslice/protolock"
@@ -44,3 +45,128 @@ func TestPluginInit(t *testing.T) {
 		return data
 	})
 }
+
+func TestDataLog(t *testing.T) {
+	data := &Data{}
+	data.Log("checked %d files", 2)
+	data.Log("done")
+
+	if len(data.PluginLogs) != 2 {
+		t.Fatalf("expected 2 log messages, got %d", len(data.PluginLogs))
+	}
+
+	if data.PluginLogs[0] != "checked 2 files" {
+		t.Logf("incorrect log message: %s", data.PluginLogs[0])
+		t.Fail()
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	// plugins which predate the handshake are treated as status plugins
+	if err := Negotiate(nil, CapabilityStatus); err != nil {
+		t.Errorf("unexpected error for legacy plugin: %v", err)
+	}
+	if err := Negotiate(nil, CapabilityCommitHook); err == nil {
+		t.Error("expected error for legacy plugin without commit-hook capability")
+	}
+
+	h := NewPlugin("test", CapabilityStatus, CapabilityCommitHook).Handshake()
+	if err := Negotiate(h, CapabilityCommitHook); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Negotiate(h, CapabilityFix); !errors.Is(err, ErrIncompatiblePlugin) {
+		t.Errorf("expected ErrIncompatiblePlugin, got: %v", err)
+	}
+
+	h = &Handshake{
+		ProtocolVersions: []int{ProtocolVersion + 1},
+		Capabilities:     []Capability{CapabilityStatus},
+	}
+	if err := Negotiate(h, CapabilityStatus); !errors.Is(err, ErrIncompatiblePlugin) {
+		t.Errorf("expected ErrIncompatiblePlugin, got: %v", err)
+	}
+}
+
+func TestPluginHandle(t *testing.T) {
+	p := NewPlugin("test")
+
+	called := false
+	out := p.Handle(&Data{ProtocolVersion: ProtocolVersion}, func(d *Data) *Data {
+		called = true
+		return d
+	})
+	if !called {
+		t.Error("expected plugin func to be called")
+	}
+	if out.Handshake == nil || !out.Handshake.HasCapability(CapabilityStatus) {
+		t.Errorf("expected handshake with status capability, got: %+v", out.Handshake)
+	}
+
+	called = false
+	out = p.Handle(&Data{ProtocolVersion: ProtocolVersion + 1}, func(d *Data) *Data {
+		called = true
+		return d
+	})
+	if called {
+		t.Error("expected plugin func not to be called for unsupported version")
+	}
+	if out.PluginErrorMessage == "" {
+		t.Error("expected plugin error message for unsupported version")
+	}
+}
+
+func TestPluginHandleMode(t *testing.T) {
+	called := false
+	fn := func(d *Data) *Data {
+		called = true
+		return d
+	}
+
+	// status plugins are not run as commit hooks
+	out := NewPlugin("test").Handle(&Data{Mode: ModePreCommit}, fn)
+	if called {
+		t.Error("expected plugin func not to be called without commit-hook capability")
+	}
+	if out.Mode != ModePreCommit {
+		t.Errorf("expected mode %q, got %q", ModePreCommit, out.Mode)
+	}
+
+	p := NewPlugin("test", CapabilityStatus, CapabilityCommitHook)
+	out = p.Handle(&Data{Mode: ModePostCommit}, fn)
+	if !called {
+		t.Error("expected plugin func to be called with commit-hook capability")
+	}
+	if out.Mode != ModePostCommit {
+		t.Errorf("expected mode %q, got %q", ModePostCommit, out.Mode)
+	}
+
+	// input without a mode is from a status call
+	out = p.Handle(&Data{}, fn)
+	if out.Mode != ModeStatus {
+		t.Errorf("expected mode %q, got %q", ModeStatus, out.Mode)
+	}
+}
+
+func TestDataIndex(t *testing.T) {
+	d := &Data{
+		Updated: protolock.Protolock{
+			Definitions: []protolock.Definition{{
+				Filepath: "a.proto",
+				Def: protolock.Entry{
+					Package:  protolock.Package{Name: "pkg"},
+					Messages: []protolock.Message{{Name: "Msg"}},
+				},
+			}},
+		},
+	}
+
+	if _, ok := d.UpdatedIndex().Message("pkg.Msg"); !ok {
+		t.Error("expected updated index to contain pkg.Msg")
+	}
+	if d.UpdatedIndex() != d.UpdatedIndex() {
+		t.Error("expected updated index to be built once")
+	}
+	if len(d.CurrentIndex().Files()) != 0 {
+		t.Error("expected empty current index")
+	}
+}
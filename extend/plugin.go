@@ -17,13 +17,52 @@ type Plugin interface {
 
 // Data contains the current and updated Protolock structs created by the
 // `protolock` internal parser and deserializer, and a slice of Warning structs
-// for the plugin to append its own custom warnings.
+// for the plugin to append its own custom warnings. When run as a commit hook,
+// Updated contains the new lock contents being committed.
 type Data struct {
 	Current            protolock.Protolock `json:"current,omitempty"`
 	Updated            protolock.Protolock `json:"updated,omitempty"`
 	ProtolockWarnings  []protolock.Warning `json:"protolock_warnings,omitempty"`
 	PluginWarnings     []protolock.Warning `json:"plugin_warnings,omitempty"`
 	PluginErrorMessage string              `json:"plugin_error_message,omitempty"`
+	// PluginLogs contains diagnostic messages from the plugin, which are
+	// printed by protolock when run with --debug.
+	PluginLogs []string `json:"plugin_logs,omitempty"`
+	// ProtocolVersion is set by protolock to the version of the Data it
+	// sends, see ProtocolVersion.
+	ProtocolVersion int `json:"protocol_version,omitempty"`
+	// Handshake is set by the plugin to describe what it supports.
+	Handshake *Handshake `json:"handshake,omitempty"`
+	// Mode is set by protolock to the point in its lifecycle at which the
+	// plugin is run, see Mode.
+	Mode Mode `json:"mode,omitempty"`
+
+	currentIndex, updatedIndex *protolock.Index
+}
+
+// CurrentIndex returns an Index of the Current Protolock, which is built on
+// first use.
+func (d *Data) CurrentIndex() *protolock.Index {
+	if d.currentIndex == nil {
+		d.currentIndex = protolock.NewIndex(d.Current)
+	}
+	return d.currentIndex
+}
+
+// UpdatedIndex returns an Index of the Updated Protolock, which is built on
+// first use.
+func (d *Data) UpdatedIndex() *protolock.Index {
+	if d.updatedIndex == nil {
+		d.updatedIndex = protolock.NewIndex(d.Updated)
+	}
+	return d.updatedIndex
+}
+
+// Log appends a diagnostic message to the PluginLogs, formatted according to a
+// format specifier. Plugins should use Log rather than write to stdout, which
+// is reserved for the Data returned to protolock.
+func (d *Data) Log(format string, args ...interface{}) {
+	d.PluginLogs = append(d.PluginLogs, fmt.Sprintf(format, args...))
 }
 
 // PluginFunc is a function which defines plugin behavior, and is provided a
@@ -31,13 +70,29 @@ type Data struct {
 type PluginFunc func(d *Data) *Data
 
 type plugin struct {
-	name string
+	name         string
+	capabilities []Capability
 }
 
-// NewPlugin returns a plugin instance for a plugin to be initialized.
-func NewPlugin(name string) *plugin {
+// NewPlugin returns a plugin instance for a plugin to be initialized. The
+// capabilities are reported to protolock in the plugin's Handshake, and
+// default to only CapabilityStatus.
+func NewPlugin(name string, capabilities ...Capability) *plugin {
+	if len(capabilities) == 0 {
+		capabilities = []Capability{CapabilityStatus}
+	}
+
 	return &plugin{
-		name: name,
+		name:         name,
+		capabilities: capabilities,
+	}
+}
+
+// Handshake returns the Handshake describing the plugin.
+func (p *plugin) Handshake() *Handshake {
+	return &Handshake{
+		ProtocolVersions: SupportedProtocolVersions,
+		Capabilities:     p.capabilities,
 	}
 }
 
@@ -60,20 +115,64 @@ func (p *plugin) Init(fn PluginFunc) {
 		return
 	}
 
+	// serialize *Data back and write to stdout
+	p.wrapErrAndLog(json.NewEncoder(os.Stdout).Encode(p.Handle(inputData, fn)))
+}
+
+// Handle checks that the input Data uses a supported protocol version, and
+// that the plugin has the capability required by its Mode, before passing it
+// to fn, and attaches the plugin's Handshake to the output Data. It is used by
+// Init, and by other transports such as the extend/wasm package.
+func (p *plugin) Handle(inputData *Data, fn PluginFunc) *Data {
+	// input from protolock versions which predate the protocol version
+	// field is treated as the first version
+	version := inputData.ProtocolVersion
+	if version == 0 {
+		version = ProtocolVersion
+	}
+
+	handshake := p.Handshake()
+	if !handshake.SupportsVersion(version) {
+		return &Data{
+			PluginErrorMessage: fmt.Sprintf(
+				"%v: protolock uses protocol version %d, plugin supports %v",
+				ErrIncompatiblePlugin, version, handshake.ProtocolVersions,
+			),
+			ProtocolVersion: version,
+			Handshake:       handshake,
+		}
+	}
+
+	// plugins without the capability required by the mode, e.g. a status
+	// plugin run as a commit hook, only return their handshake
+	mode := inputData.Mode
+	if mode == "" {
+		mode = ModeStatus
+	}
+	if !handshake.HasCapability(mode.Capability()) {
+		return &Data{
+			ProtocolVersion: version,
+			Handshake:       handshake,
+			Mode:            mode,
+		}
+	}
+
 	// execute "fn" and pass it the *Data, where the plugin would read and
 	// compare the current and updated Protolock values and append custom
 	// Warnings for their own defined rules
 	outputData := fn(inputData)
 	outputData.Current = inputData.Current
 	outputData.Updated = inputData.Updated
+	outputData.ProtocolVersion = version
+	outputData.Handshake = handshake
+	outputData.Mode = mode
 
-	// serialize *Data back and write to stdout
-	p.wrapErrAndLog(json.NewEncoder(os.Stdout).Encode(outputData))
+	return outputData
 }
 
 func (p *plugin) wrapErrAndLog(err error) {
 	if err != nil {
-		fmt.Fprintf(os.Stdout, "[protolock:plugin] %s: %v", p.name, err)
+		fmt.Fprintf(os.Stderr, "[protolock:plugin] %s: %v\n", p.name, err)
 	}
 }
 
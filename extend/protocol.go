@@ -0,0 +1,119 @@
+package extend
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProtocolVersion is the version of the Data exchanged between protolock and
+// its plugins. It must be incremented whenever Data, or the Protolock it
+// contains, changes in a way older plugins cannot safely ignore.
+const ProtocolVersion = 1
+
+// SupportedProtocolVersions lists every protocol version this package can
+// read and write.
+var SupportedProtocolVersions = []int{ProtocolVersion}
+
+// Capability names an operation a plugin is able to perform.
+type Capability string
+
+const (
+	// CapabilityStatus indicates the plugin checks the Data from a
+	// `protolock status` call and may add warnings.
+	CapabilityStatus Capability = "status"
+
+	// CapabilityCommitHook indicates the plugin is run as part of a
+	// `protolock commit` call.
+	CapabilityCommitHook Capability = "commit-hook"
+
+	// CapabilityFix indicates the plugin can suggest fixes for warnings.
+	CapabilityFix Capability = "fix"
+)
+
+// Mode is the point in the protolock lifecycle at which a plugin is run.
+type Mode string
+
+const (
+	// ModeStatus runs the plugin as part of a `protolock status` call, and is
+	// assumed when the Data has no Mode.
+	ModeStatus Mode = "status"
+
+	// ModePreCommit runs the plugin before `protolock commit` writes the
+	// proto.lock file. Warnings which are errors, or a PluginErrorMessage,
+	// prevent the commit.
+	ModePreCommit Mode = "pre-commit"
+
+	// ModePostCommit runs the plugin after `protolock commit` has written the
+	// proto.lock file.
+	ModePostCommit Mode = "post-commit"
+)
+
+// Capability returns the Capability a plugin needs to be run in the mode.
+func (m Mode) Capability() Capability {
+	switch m {
+	case ModePreCommit, ModePostCommit:
+		return CapabilityCommitHook
+	default:
+		return CapabilityStatus
+	}
+}
+
+// ErrIncompatiblePlugin indicates that protolock and a plugin share no
+// protocol version, or the plugin lacks a required capability.
+var ErrIncompatiblePlugin = errors.New("incompatible plugin")
+
+// Handshake is returned by a plugin to describe the protocol versions and
+// capabilities it supports.
+type Handshake struct {
+	ProtocolVersions []int        `json:"protocol_versions,omitempty"`
+	Capabilities     []Capability `json:"capabilities,omitempty"`
+}
+
+// SupportsVersion reports whether the plugin supports the protocol version.
+func (h *Handshake) SupportsVersion(version int) bool {
+	for _, v := range h.ProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCapability reports whether the plugin has the capability.
+func (h *Handshake) HasCapability(c Capability) bool {
+	for _, hc := range h.Capabilities {
+		if hc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate checks that a plugin which returned the Handshake h can be used
+// for the required capability at the current ProtocolVersion. A nil Handshake
+// is returned by plugins built before the protocol was versioned, which are
+// assumed to only support the "status" capability.
+func Negotiate(h *Handshake, required Capability) error {
+	if h == nil {
+		h = &Handshake{
+			ProtocolVersions: []int{ProtocolVersion},
+			Capabilities:     []Capability{CapabilityStatus},
+		}
+	}
+
+	if !h.SupportsVersion(ProtocolVersion) {
+		return fmt.Errorf(
+			"%w: plugin supports protocol versions %v, protolock uses %d",
+			ErrIncompatiblePlugin, h.ProtocolVersions, ProtocolVersion,
+		)
+	}
+
+	if !h.HasCapability(required) {
+		return fmt.Errorf(
+			"%w: plugin capabilities %v do not include %q",
+			ErrIncompatiblePlugin, h.Capabilities, required,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+//go:build wasm
+
+// Package wasm runs protolock plugins as Extism WASM modules, using the same
+// extend.PluginFunc as native plugins, so that one plugin implementation can
+// be compiled to both a native binary and a .wasm module.
+//
+// A WASM plugin must export a "status" function, and may export a "handshake"
+// function, each calling into a plugin returned by NewPlugin:
+//
+//	var plugin = wasm.NewPlugin("sample")
+//
+//	//go:wasmexport status
+//	func status() int32 { return plugin.Run(check) }
+//
+//	//go:wasmexport handshake
+//	func handshake() int32 { return plugin.RunHandshake() }
+//
+// Plugins are built with Go 1.24 or later, which supports go:wasmexport:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o status.wasm
+//
+// Plugins created with extend.CapabilityCommitHook may also export
+// "pre_commit" and "post_commit" functions, which are called by
+// `protolock commit` and should also call Run. The Data's Mode tells the
+// PluginFunc which hook is being run.
+package wasm
+
+import (
+	"encoding/json"
+
+	pdk "github.com/extism/go-pdk"
+	"github.com/nilslice/protolock/extend"
+)
+
+// handler is implemented by the plugin returned from extend.NewPlugin.
+type handler interface {
+	Handle(*extend.Data, extend.PluginFunc) *extend.Data
+	Handshake() *extend.Handshake
+}
+
+type plugin struct {
+	name    string
+	handler handler
+}
+
+// NewPlugin returns a plugin instance for a WASM plugin to be run. The
+// capabilities are reported to protolock in the plugin's Handshake, and
+// default to only extend.CapabilityStatus.
+func NewPlugin(name string, capabilities ...extend.Capability) *plugin {
+	return &plugin{
+		name:    name,
+		handler: extend.NewPlugin(name, capabilities...),
+	}
+}
+
+// Init satisfies the extend.Plugin interface, see Run.
+func (p *plugin) Init(fn extend.PluginFunc) {
+	p.Run(fn)
+}
+
+// Run reads the input Data from the host using the Extism PDK, passes it to fn
+// and outputs the resulting Data back to the host. The returned int32 should
+// be returned from the exported function, and is non-zero on error.
+func (p *plugin) Run(fn extend.PluginFunc) int32 {
+	inputData := &extend.Data{}
+	err := json.Unmarshal(pdk.Input(), inputData)
+	if err != nil {
+		return p.setError(err)
+	}
+
+	return p.output(p.handler.Handle(inputData, fn))
+}
+
+// RunHandshake outputs the plugin's Handshake to the host, and should be
+// called from an exported "handshake" function.
+func (p *plugin) RunHandshake() int32 {
+	return p.output(p.handler.Handshake())
+}
+
+func (p *plugin) output(v interface{}) int32 {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return p.setError(err)
+	}
+
+	pdk.Output(b)
+	return 0
+}
+
+func (p *plugin) setError(err error) int32 {
+	pdk.SetErrorString("[protolock:plugin] " + p.name + ": " + err.Error())
+	return 1
+}
+
+var _ extend.Plugin = &plugin{}
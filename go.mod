@@ -1,17 +1,18 @@
 module github.com/nilslice/protolock
 
-go 1.21
+go 1.21.0
 
 require (
 	github.com/emicklei/proto v1.13.2
+	github.com/extism/go-pdk v1.0.0
 	github.com/extism/go-sdk v1.0.0
 	github.com/stretchr/testify v1.8.4
+	github.com/tetratelabs/wazero v1.3.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gobwas/glob v0.2.3 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/tetratelabs/wazero v1.3.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
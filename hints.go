@@ -64,9 +64,11 @@ func hints(c *proto.Comment) []error {
 	return errs
 }
 
+// debugHint writes the hint to the debug writer of the default Engine, as the
+// proto files are parsed.
 func debugHint(c *proto.Comment, hint string) {
-	if debug {
-		fmt.Println(
+	if w := std.Debug; w != nil {
+		fmt.Fprintln(w,
 			"HINT:", hint,
 			fmt.Sprintf(
 				"%s:%d:%d",
@@ -0,0 +1,384 @@
+package protolock
+
+import (
+	"sort"
+	"strings"
+)
+
+// Index is a read-only view over a Protolock, built once by NewIndex, which
+// looks up its definitions by file and by fully-qualified name. A
+// fully-qualified name is the package name followed by the names of any
+// parent messages, e.g. "pkg.Outer.Inner". Enums are indexed by the package
+// and enum name only, as the parser does not record the messages in which they
+// are nested.
+//
+// The Index is safe for concurrent use, and neither the Index nor the values
+// it returns may be modified.
+type Index struct {
+	lock Protolock
+
+	files    map[Protopath]Entry
+	paths    []Protopath
+	messages map[string]*IndexedMessage
+	enums    map[string]*IndexedEnum
+	services map[string]*IndexedService
+
+	// the messages, enums and services defined by each indexed file, keyed
+	// by fully-qualified name, which include those whose names are also
+	// defined by another file, in the order of the files and their
+	// declarations
+	fileMessages    map[Protopath]map[string]*IndexedMessage
+	fileEnums       map[Protopath]map[string]*IndexedEnum
+	fileServices    map[Protopath]map[string]*IndexedService
+	definedMessages []*IndexedMessage
+	definedEnums    []*IndexedEnum
+	definedServices []*IndexedService
+}
+
+// IndexedMessage is a Message found in an Index, whose fields, including
+// those of its maps, can be looked up by ID and by name.
+type IndexedMessage struct {
+	// Name is the fully-qualified name of the message.
+	Name     string
+	Filepath Protopath
+	Message  Message
+	// Included is true if it is defined by the includes of the Index.
+	Included bool
+
+	// local is the name of the message within its file, e.g. "Outer.Inner"
+	local        string
+	fieldsByID   map[int]Field
+	fieldsByName map[string]Field
+}
+
+// FieldByID returns the field of the message with the ID.
+func (m *IndexedMessage) FieldByID(id int) (Field, bool) {
+	f, ok := m.fieldsByID[id]
+	return f, ok
+}
+
+// FieldByName returns the field of the message with the name.
+func (m *IndexedMessage) FieldByName(name string) (Field, bool) {
+	f, ok := m.fieldsByName[name]
+	return f, ok
+}
+
+// fields returns the fields of the message, followed by those of its maps.
+func (m *IndexedMessage) fields() []Field {
+	fields := append([]Field(nil), m.Message.Fields...)
+	for _, mp := range m.Message.Maps {
+		fields = append(fields, mp.Field)
+	}
+	return fields
+}
+
+// IndexedEnum is an Enum found in an Index, whose values can be looked up by
+// name and by number.
+type IndexedEnum struct {
+	// Name is the fully-qualified name of the enum.
+	Name     string
+	Filepath Protopath
+	Enum     Enum
+	// Included is true if it is defined by the includes of the Index.
+	Included bool
+
+	valuesByName   map[string]EnumField
+	valuesByNumber map[int][]EnumField
+}
+
+// ValueByName returns the value of the enum with the name.
+func (e *IndexedEnum) ValueByName(name string) (EnumField, bool) {
+	v, ok := e.valuesByName[name]
+	return v, ok
+}
+
+// ValuesByNumber returns the values of the enum with the number, of which
+// there is more than one when aliases are allowed.
+func (e *IndexedEnum) ValuesByNumber(number int) []EnumField {
+	return e.valuesByNumber[number]
+}
+
+// IndexedService is a Service found in an Index, whose RPCs can be looked up
+// by name.
+type IndexedService struct {
+	// Name is the fully-qualified name of the service.
+	Name     string
+	Filepath Protopath
+	Service  Service
+	// Included is true if it is defined by the includes of the Index.
+	Included bool
+
+	rpcsByName map[string]RPC
+}
+
+// RPC returns the RPC of the service with the name.
+func (s *IndexedService) RPC(name string) (RPC, bool) {
+	rpc, ok := s.rpcsByName[name]
+	return rpc, ok
+}
+
+// NewIndex indexes the definitions of the Protolock. The definitions of
+// includes, such as the files of include-only proto roots, are also indexed
+// so that types they define can be found and resolved, but their files are
+// not part of the Index. When a name is defined more than once, the definition
+// in the first file, ordered by path, is indexed, preferring the Protolock
+// over its includes.
+func NewIndex(lock Protolock, includes ...Protolock) *Index {
+	x := &Index{
+		lock:         lock,
+		files:        make(map[Protopath]Entry),
+		messages:     make(map[string]*IndexedMessage),
+		enums:        make(map[string]*IndexedEnum),
+		services:     make(map[string]*IndexedService),
+		fileMessages: make(map[Protopath]map[string]*IndexedMessage),
+		fileEnums:    make(map[Protopath]map[string]*IndexedEnum),
+		fileServices: make(map[Protopath]map[string]*IndexedService),
+	}
+
+	for _, def := range sortedDefinitions(lock) {
+		if _, ok := x.files[def.Filepath]; ok {
+			continue
+		}
+		x.files[def.Filepath] = def.Def
+		x.paths = append(x.paths, def.Filepath)
+		x.addDefinition(def, false)
+	}
+
+	included := make(map[Protopath]bool)
+	for _, include := range includes {
+		for _, def := range sortedDefinitions(include) {
+			if _, ok := x.files[def.Filepath]; ok || included[def.Filepath] {
+				continue
+			}
+			included[def.Filepath] = true
+			x.addDefinition(def, true)
+		}
+	}
+
+	return x
+}
+
+func sortedDefinitions(lock Protolock) []Definition {
+	defs := append([]Definition(nil), lock.Definitions...)
+	sort.SliceStable(defs, func(i, j int) bool {
+		return defs[i].Filepath < defs[j].Filepath
+	})
+	return defs
+}
+
+func (x *Index) addDefinition(def Definition, included bool) {
+	pkg := def.Def.Package.Name
+
+	for _, msg := range def.Def.Messages {
+		x.addMessage(def.Filepath, pkg, "", msg, included)
+	}
+
+	for _, enum := range def.Def.Enums {
+		e := &IndexedEnum{
+			Name:           joinPath(pkg, enum.Name),
+			Filepath:       def.Filepath,
+			Enum:           enum,
+			Included:       included,
+			valuesByName:   make(map[string]EnumField),
+			valuesByNumber: make(map[int][]EnumField),
+		}
+		for _, v := range enum.EnumFields {
+			if _, ok := e.valuesByName[v.Name]; !ok {
+				e.valuesByName[v.Name] = v
+			}
+			e.valuesByNumber[v.Integer] = append(e.valuesByNumber[v.Integer], v)
+		}
+
+		if _, ok := x.enums[e.Name]; !ok {
+			x.enums[e.Name] = e
+		}
+		if !included {
+			if x.fileEnums[def.Filepath] == nil {
+				x.fileEnums[def.Filepath] = make(map[string]*IndexedEnum)
+			}
+			x.fileEnums[def.Filepath][e.Name] = e
+			x.definedEnums = append(x.definedEnums, e)
+		}
+	}
+
+	for _, svc := range def.Def.Services {
+		s := &IndexedService{
+			Name:       joinPath(pkg, svc.Name),
+			Filepath:   def.Filepath,
+			Service:    svc,
+			Included:   included,
+			rpcsByName: make(map[string]RPC),
+		}
+		for _, rpc := range svc.RPCs {
+			s.rpcsByName[rpc.Name] = rpc
+		}
+
+		if _, ok := x.services[s.Name]; !ok {
+			x.services[s.Name] = s
+		}
+		if !included {
+			if x.fileServices[def.Filepath] == nil {
+				x.fileServices[def.Filepath] = make(map[string]*IndexedService)
+			}
+			x.fileServices[def.Filepath][s.Name] = s
+			x.definedServices = append(x.definedServices, s)
+		}
+	}
+}
+
+func (x *Index) addMessage(path Protopath, pkg, parent string, msg Message, included bool) {
+	local := joinPath(parent, msg.Name)
+	m := &IndexedMessage{
+		Name:         joinPath(pkg, local),
+		Filepath:     path,
+		Message:      msg,
+		Included:     included,
+		local:        local,
+		fieldsByID:   make(map[int]Field),
+		fieldsByName: make(map[string]Field),
+	}
+	for _, f := range m.fields() {
+		m.fieldsByID[f.ID] = f
+		m.fieldsByName[f.Name] = f
+	}
+
+	if _, ok := x.messages[m.Name]; !ok {
+		x.messages[m.Name] = m
+	}
+	if !included {
+		if x.fileMessages[path] == nil {
+			x.fileMessages[path] = make(map[string]*IndexedMessage)
+		}
+		x.fileMessages[path][m.Name] = m
+		x.definedMessages = append(x.definedMessages, m)
+	}
+
+	for _, nested := range msg.Messages {
+		x.addMessage(path, pkg, local, nested, included)
+	}
+}
+
+// matchMessage returns the message of the Index which corresponds to a
+// message of another Index: the message with the same name defined by the
+// same file. A message moved to another file does not correspond, so the move
+// is reported by the rules as the removal of the message. matchEnum and
+// matchService find the enums and services which correspond in the same way.
+func (x *Index) matchMessage(m *IndexedMessage) (*IndexedMessage, bool) {
+	match, ok := x.fileMessages[m.Filepath][m.Name]
+	return match, ok
+}
+
+func (x *Index) matchEnum(e *IndexedEnum) (*IndexedEnum, bool) {
+	match, ok := x.fileEnums[e.Filepath][e.Name]
+	return match, ok
+}
+
+func (x *Index) matchService(s *IndexedService) (*IndexedService, bool) {
+	match, ok := x.fileServices[s.Filepath][s.Name]
+	return match, ok
+}
+
+// Lock returns the indexed Protolock.
+func (x *Index) Lock() Protolock {
+	return x.lock
+}
+
+// Files returns the paths of the indexed files, in order.
+func (x *Index) Files() []Protopath {
+	return append([]Protopath(nil), x.paths...)
+}
+
+// File returns the definitions of the file at the path.
+func (x *Index) File(path Protopath) (Entry, bool) {
+	entry, ok := x.files[path]
+	return entry, ok
+}
+
+// Message returns the message with the fully-qualified name.
+func (x *Index) Message(name string) (*IndexedMessage, bool) {
+	m, ok := x.messages[name]
+	return m, ok
+}
+
+// Messages returns all indexed messages, ordered by name.
+func (x *Index) Messages() []*IndexedMessage {
+	messages := make([]*IndexedMessage, 0, len(x.messages))
+	for _, m := range x.messages {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Name < messages[j].Name
+	})
+	return messages
+}
+
+// Enum returns the enum with the fully-qualified name.
+func (x *Index) Enum(name string) (*IndexedEnum, bool) {
+	e, ok := x.enums[name]
+	return e, ok
+}
+
+// Enums returns all indexed enums, ordered by name.
+func (x *Index) Enums() []*IndexedEnum {
+	enums := make([]*IndexedEnum, 0, len(x.enums))
+	for _, e := range x.enums {
+		enums = append(enums, e)
+	}
+	sort.Slice(enums, func(i, j int) bool {
+		return enums[i].Name < enums[j].Name
+	})
+	return enums
+}
+
+// Service returns the service with the fully-qualified name.
+func (x *Index) Service(name string) (*IndexedService, bool) {
+	s, ok := x.services[name]
+	return s, ok
+}
+
+// Services returns all indexed services, ordered by name.
+func (x *Index) Services() []*IndexedService {
+	services := make([]*IndexedService, 0, len(x.services))
+	for _, s := range x.services {
+		services = append(services, s)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	return services
+}
+
+// ResolveType returns the fully-qualified name of the message or enum which
+// the type name refers to from within scope, which is the fully-qualified name
+// of a package or message. As in protoc, the name is looked up in the scope,
+// then in each enclosing scope, and names beginning with "." are already
+// fully-qualified. Scalar types and unknown names are not resolved.
+func (x *Index) ResolveType(scope, name string) (string, bool) {
+	if strings.HasPrefix(name, nestedPrefix) {
+		name = strings.TrimPrefix(name, nestedPrefix)
+		return name, x.hasType(name)
+	}
+
+	for {
+		candidate := joinPath(scope, name)
+		if x.hasType(candidate) {
+			return candidate, true
+		}
+		if scope == "" {
+			return "", false
+		}
+
+		i := strings.LastIndex(scope, nestedPrefix)
+		if i < 0 {
+			scope = ""
+		} else {
+			scope = scope[:i]
+		}
+	}
+}
+
+func (x *Index) hasType(name string) bool {
+	_, isMessage := x.messages[name]
+	_, isEnum := x.enums[name]
+	return isMessage || isEnum
+}
@@ -0,0 +1,163 @@
+package protolock
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const indexProto = `syntax = "proto3";
+package test.v1;
+
+message Outer {
+  string name = 1;
+  map<string, int32> counts = 2;
+  message Inner {
+    int64 id = 1;
+  }
+}
+
+enum Status {
+  option allow_alias = true;
+  UNKNOWN = 0;
+  STARTED = 1;
+  RUNNING = 1;
+}
+
+service Jobs {
+  rpc Run (Outer) returns (Outer.Inner);
+}
+`
+
+func TestIndex(t *testing.T) {
+	lock := parseTestProto(t, indexProto)
+	x := NewIndex(lock)
+
+	assert.Equal(t, lock, x.Lock())
+	assert.Equal(t, []Protopath{"memory/io.Reader"}, x.Files())
+
+	entry, ok := x.File("memory/io.Reader")
+	assert.True(t, ok)
+	assert.Equal(t, "test.v1", entry.Package.Name)
+	_, ok = x.File("missing.proto")
+	assert.False(t, ok)
+
+	outer, ok := x.Message("test.v1.Outer")
+	require.True(t, ok)
+	assert.Equal(t, Protopath("memory/io.Reader"), outer.Filepath)
+	f, ok := outer.FieldByID(1)
+	assert.True(t, ok)
+	assert.Equal(t, "name", f.Name)
+	f, ok = outer.FieldByName("counts")
+	assert.True(t, ok)
+	assert.Equal(t, 2, f.ID)
+	_, ok = outer.FieldByID(3)
+	assert.False(t, ok)
+
+	inner, ok := x.Message("test.v1.Outer.Inner")
+	require.True(t, ok)
+	assert.Equal(t, "Inner", inner.Message.Name)
+	_, ok = x.Message("Outer")
+	assert.False(t, ok)
+
+	var names []string
+	for _, m := range x.Messages() {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"test.v1.Outer", "test.v1.Outer.Inner"}, names)
+
+	status, ok := x.Enum("test.v1.Status")
+	require.True(t, ok)
+	v, ok := status.ValueByName("RUNNING")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v.Integer)
+	assert.Len(t, status.ValuesByNumber(1), 2)
+	assert.Len(t, x.Enums(), 1)
+
+	jobs, ok := x.Service("test.v1.Jobs")
+	require.True(t, ok)
+	rpc, ok := jobs.RPC("Run")
+	assert.True(t, ok)
+	assert.Equal(t, "Outer.Inner", rpc.OutType)
+	assert.Len(t, x.Services(), 1)
+}
+
+func TestRegisterIndexRule(t *testing.T) {
+	var rules []Rule
+	var seen *Index
+	err := registerRule(&rules, Rule{
+		Name: "IndexOnly",
+		IndexFunc: func(cur, upd *Index) ([]Warning, bool) {
+			seen = upd
+			return nil, true
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, rules[0].Func)
+
+	lock := parseTestProto(t, indexProto)
+	_, ok := rules[0].Func(lock, lock)
+	assert.True(t, ok)
+	require.NotNil(t, seen)
+	_, ok = seen.Message("test.v1.Outer")
+	assert.True(t, ok)
+
+	// an Engine passes the same Index to every rule
+	engine := &Engine{}
+	var mu sync.Mutex
+	var indexes []*Index
+	for _, name := range []string{"A", "B"} {
+		err := engine.RegisterRule(Rule{
+			Name: name,
+			IndexFunc: func(cur, upd *Index) ([]Warning, bool) {
+				mu.Lock()
+				defer mu.Unlock()
+				indexes = append(indexes, cur)
+				return nil, true
+			},
+		})
+		require.NoError(t, err)
+	}
+	_, err = engine.Compare(lock, lock)
+	assert.NoError(t, err)
+	require.Len(t, indexes, 2)
+	assert.Same(t, indexes[0], indexes[1])
+}
+
+func TestIndexMatchesDefinitionsByFile(t *testing.T) {
+	def := func(path, proto string) Definition {
+		entry, err := Parse(path, strings.NewReader(proto))
+		require.NoError(t, err)
+		return Definition{Filepath: Protopath(path), Def: entry}
+	}
+	const withField = `syntax = "proto3"; package dup; message Thing { string name = 1; }`
+	const withoutField = `syntax = "proto3"; package dup; message Thing { }`
+
+	// a name defined by more than one file is compared within each file
+	cur := Protolock{Definitions: []Definition{
+		def("a.proto", withField), def("b.proto", withField),
+	}}
+	upd := Protolock{Definitions: []Definition{
+		def("a.proto", withField), def("b.proto", withoutField),
+	}}
+	warnings, ok := NoRemovingFieldsWithoutReserve(cur, upd)
+	assert.False(t, ok)
+	require.Len(t, warnings, 2)
+	for _, w := range warnings {
+		assert.Equal(t, Protopath("b.proto"), w.Filepath)
+	}
+
+	// a definition moved to another file does not correspond to the one in
+	// its previous file, so the move is reported as a removal
+	upd = Protolock{Definitions: []Definition{def("c.proto", withField)}}
+	cur = Protolock{Definitions: []Definition{def("a.proto", withField)}}
+	warnings, ok = NoRemovingFieldsWithoutReserve(cur, upd)
+	assert.False(t, ok)
+	require.Len(t, warnings, 2)
+	orderByPathAndMessage(warnings)
+	assert.Equal(t, `"Thing" ID: "1" has been removed, but is not reserved`, warnings[0].Message)
+	assert.Equal(t, `"Thing" field: "name" has been removed, but is not reserved`, warnings[1].Message)
+}
@@ -1,24 +1,34 @@
 package protolock
 
 import (
-	"encoding/json"
-	"fmt"
+	"bytes"
+	"context"
+	"errors"
 	"io"
-	"os"
-	"strings"
 )
 
 const protoSuffix = ".proto"
 
+// ErrLockExists indicates that a proto.lock file already exists, and must be
+// updated using Commit rather than Init.
+var ErrLockExists = errors.New(
+	`a "proto.lock" file was already found, use "commit" to update`,
+)
+
 // Init will return an io.Reader with the lock representation data for caller to
-// use as needed.
+// use as needed. ErrLockExists is returned if the proto.lock file exists.
 func Init(cfg Config) (io.Reader, error) {
+	return InitContext(context.Background(), cfg)
+}
+
+// InitContext is like Init, but stops parsing proto files and returns the
+// context's error if ctx is done.
+func InitContext(ctx context.Context, cfg Config) (io.Reader, error) {
 	if cfg.LockFileExists() {
-		fmt.Println(`a "proto.lock" file was already found, use "commit" to update`)
-		os.Exit(1)
+		return nil, ErrLockExists
 	}
 
-	updated, err := getUpdatedLock(cfg)
+	updated, err := getUpdatedLock(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -26,11 +36,13 @@ func Init(cfg Config) (io.Reader, error) {
 	return readerFromProtolock(updated)
 }
 
+// readerFromProtolock returns a reader of the canonical JSON encoding of the
+// Protolock, see WriteLock.
 func readerFromProtolock(lock *Protolock) (io.Reader, error) {
-	b, err := json.MarshalIndent(lock, "", "  ")
+	b, err := MarshalLock(*lock)
 	if err != nil {
 		return nil, err
 	}
 
-	return strings.NewReader(string(b)), nil
+	return bytes.NewReader(b), nil
 }
@@ -0,0 +1,33 @@
+package protolock
+
+import (
+	"io"
+	"log"
+)
+
+// Logger receives diagnostic messages, such as debug output and errors which
+// do not prevent an operation from completing. It is satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logger discards all messages until one is provided using SetLogger, so that
+// the package never writes to stdout or stderr on its own.
+var logger Logger = log.New(io.Discard, "", 0)
+
+// SetLogger enables the user to receive diagnostic messages. A nil Logger
+// discards all messages.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = log.New(io.Discard, "", 0)
+	}
+	logger = l
+}
+
+// logWriter is an io.Writer which passes everything written to the logger.
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	logger.Printf("%s", p)
+	return len(p), nil
+}
@@ -0,0 +1,369 @@
+package protolock
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrMergeConflict indicates that Protolocks cannot be merged, because both
+// sides changed the same definition in different ways, or their changes
+// conflict, e.g. by adding different fields with the same ID.
+var ErrMergeConflict = errors.New("proto.lock merge conflict")
+
+// MergeConflict describes a definition which could not be merged.
+type MergeConflict struct {
+	Filepath Protopath
+	// EntityPath is the path of the definition within the file, e.g.
+	// "Outer.Inner.field".
+	EntityPath string
+	Message    string
+}
+
+// MergeError is returned by Merge when there are conflicts, and matches
+// ErrMergeConflict using errors.Is.
+type MergeError struct {
+	Conflicts []MergeConflict
+}
+
+func (e *MergeError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(ErrMergeConflict.Error())
+	for _, c := range e.Conflicts {
+		fmt.Fprintf(&sb, "\n%s", OSPath(c.Filepath))
+		if c.EntityPath != "" {
+			fmt.Fprintf(&sb, ": %s", c.EntityPath)
+		}
+		fmt.Fprintf(&sb, ": %s", c.Message)
+	}
+	return sb.String()
+}
+
+func (e *MergeError) Unwrap() error {
+	return ErrMergeConflict
+}
+
+// Merge performs a three-way merge of the changes made to base by ours and
+// theirs, such as two branches which both committed their proto.lock file.
+// Files, messages, fields, maps, enums, enum values, services, RPCs, imports
+// and the options of files, messages and enums are merged individually, so
+// that changes to different definitions never conflict. A *MergeError
+// listing the conflicts is returned if both sides changed the same definition
+// differently, if one side changed a definition which the other removed, or if
+// the merged result is inconsistent, e.g. a message uses a field ID twice, or
+// uses a reserved field ID or name.
+func Merge(base, ours, theirs Protolock) (*Protolock, error) {
+	m := &merger{}
+	merged := Protolock{Version: LockVersion}
+	merged.Definitions = mergeList(m, "",
+		base.Definitions, ours.Definitions, theirs.Definitions,
+		func(d Definition) string { return string(d.Filepath) },
+		func(_ string, b *Definition, o, t Definition) Definition {
+			m.file = o.Filepath
+			var bEntry *Entry
+			if b != nil {
+				bEntry = &b.Def
+			}
+			o.Def = m.mergeEntry(bEntry, o.Def, t.Def)
+			m.file = ""
+			return o
+		},
+	)
+
+	if len(m.conflicts) != 0 {
+		return nil, &MergeError{Conflicts: m.conflicts}
+	}
+
+	return &merged, nil
+}
+
+// merger records the conflicts found while merging.
+type merger struct {
+	file      Protopath
+	conflicts []MergeConflict
+}
+
+func (m *merger) conflict(path, format string, args ...interface{}) {
+	file := m.file
+	if file == "" {
+		file = Protopath(path)
+		path = ""
+	}
+	m.conflicts = append(m.conflicts, MergeConflict{
+		Filepath:   file,
+		EntityPath: path,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+// mergeList merges lists of definitions identified by key. Definitions changed
+// by both sides are merged using both, which is passed the base definition if
+// there is one, or are a conflict if both is nil. Definitions are ordered as in
+// ours, followed by those added by theirs.
+func mergeList[T any](
+	m *merger,
+	path string,
+	base, ours, theirs []T,
+	key func(T) string,
+	both func(path string, b *T, o, t T) T,
+) []T {
+	baseMap, oursMap, theirsMap := keyed(base, key), keyed(ours, key), keyed(theirs, key)
+
+	var merged []T
+	for _, o := range ours {
+		k := key(o)
+		b, inBase := baseMap[k]
+		t, inTheirs := theirsMap[k]
+
+		switch {
+		case inTheirs:
+			switch {
+			case reflect.DeepEqual(o, t):
+				merged = append(merged, o)
+			case inBase && reflect.DeepEqual(b, o):
+				merged = append(merged, t)
+			case inBase && reflect.DeepEqual(b, t):
+				merged = append(merged, o)
+			case both != nil:
+				var bp *T
+				if inBase {
+					bp = &b
+				}
+				merged = append(merged, both(joinPath(path, k), bp, o, t))
+			default:
+				m.conflict(joinPath(path, k), "changed differently on both sides")
+				merged = append(merged, o)
+			}
+
+		case inBase:
+			// removed by theirs, which conflicts with any change by ours
+			if !reflect.DeepEqual(b, o) {
+				m.conflict(joinPath(path, k), "changed on one side, removed on the other")
+				merged = append(merged, o)
+			}
+
+		default:
+			merged = append(merged, o)
+		}
+	}
+
+	for _, t := range theirs {
+		k := key(t)
+		if _, inOurs := oursMap[k]; inOurs {
+			continue
+		}
+
+		b, inBase := baseMap[k]
+		switch {
+		case !inBase:
+			merged = append(merged, t)
+		case !reflect.DeepEqual(b, t):
+			// removed by ours, which conflicts with any change by theirs
+			m.conflict(joinPath(path, k), "changed on one side, removed on the other")
+			merged = append(merged, t)
+		}
+	}
+
+	return merged
+}
+
+func keyed[T any](list []T, key func(T) string) map[string]T {
+	items := make(map[string]T, len(list))
+	for _, item := range list {
+		if _, ok := items[key(item)]; !ok {
+			items[key(item)] = item
+		}
+	}
+	return items
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + nestedPrefix + name
+}
+
+// mergeValue merges a value changed by ours, theirs or both, which is a
+// conflict unless both changed it in the same way.
+func mergeValue[T any](m *merger, path, name string, b, o, t T) T {
+	switch {
+	case reflect.DeepEqual(o, t):
+		return o
+	case reflect.DeepEqual(b, o):
+		return t
+	case reflect.DeepEqual(b, t):
+		return o
+	}
+
+	m.conflict(path, "%s changed differently on both sides", name)
+	return o
+}
+
+// mergeSet merges sets of values, keeping those added by either side and
+// dropping those removed by either side.
+func mergeSet[T comparable](base, ours, theirs []T) []T {
+	inBase, inOurs, inTheirs := set(base), set(ours), set(theirs)
+
+	var merged []T
+	for _, v := range ours {
+		if inTheirs[v] || !inBase[v] {
+			merged = append(merged, v)
+		}
+	}
+	for _, v := range theirs {
+		if !inOurs[v] && !inBase[v] {
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
+// mergeOptions merges options by name, so that changes to different options
+// never conflict. Repeated options with the same name are merged as one.
+func (m *merger) mergeOptions(path string, base, ours, theirs []Option) []Option {
+	groups := mergeList(m, path,
+		groupOptions(base), groupOptions(ours), groupOptions(theirs),
+		func(g []Option) string { return g[0].Name }, nil,
+	)
+
+	var merged []Option
+	for _, g := range groups {
+		merged = append(merged, g...)
+	}
+	return merged
+}
+
+// groupOptions groups the options by name, in order of their first use.
+func groupOptions(opts []Option) [][]Option {
+	var groups [][]Option
+	index := make(map[string]int)
+	for _, opt := range opts {
+		i, ok := index[opt.Name]
+		if !ok {
+			i = len(groups)
+			index[opt.Name] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], opt)
+	}
+	return groups
+}
+
+func set[T comparable](list []T) map[T]bool {
+	s := make(map[T]bool, len(list))
+	for _, v := range list {
+		s[v] = true
+	}
+	return s
+}
+
+func (m *merger) mergeEntry(b *Entry, o, t Entry) Entry {
+	if b == nil {
+		b = &Entry{}
+	}
+
+	o.Syntax = mergeValue(m, "", "syntax", b.Syntax, o.Syntax, t.Syntax)
+	o.Package = mergeValue(m, "", "package", b.Package, o.Package, t.Package)
+	o.Options = m.mergeOptions("", b.Options, o.Options, t.Options)
+	o.Imports = mergeList(m, "", b.Imports, o.Imports, t.Imports,
+		func(i Import) string { return i.Path }, nil,
+	)
+	o.Messages = mergeList(m, "", b.Messages, o.Messages, t.Messages,
+		func(msg Message) string { return msg.Name }, m.mergeMessage,
+	)
+	o.Enums = mergeList(m, "", b.Enums, o.Enums, t.Enums,
+		func(e Enum) string { return e.Name }, m.mergeEnum,
+	)
+	o.Services = mergeList(m, "", b.Services, o.Services, t.Services,
+		func(s Service) string { return s.Name }, m.mergeService,
+	)
+
+	return o
+}
+
+func (m *merger) mergeMessage(path string, b *Message, o, t Message) Message {
+	if b == nil {
+		b = &Message{}
+	}
+
+	o.Options = m.mergeOptions(path, b.Options, o.Options, t.Options)
+	o.ReservedIDs = mergeSet(b.ReservedIDs, o.ReservedIDs, t.ReservedIDs)
+	o.ReservedNames = mergeSet(b.ReservedNames, o.ReservedNames, t.ReservedNames)
+	o.Fields = mergeList(m, path, b.Fields, o.Fields, t.Fields,
+		func(f Field) string { return f.Name }, nil,
+	)
+	o.Maps = mergeList(m, path, b.Maps, o.Maps, t.Maps,
+		func(mp Map) string { return mp.Field.Name }, nil,
+	)
+	o.Messages = mergeList(m, path, b.Messages, o.Messages, t.Messages,
+		func(msg Message) string { return msg.Name }, m.mergeMessage,
+	)
+
+	// both sides may have added fields which are valid on their own, but
+	// not once merged
+	reservedIDs, reservedNames := set(o.ReservedIDs), set(o.ReservedNames)
+	fieldIDs := make(map[int]string)
+	fields := append([]Field(nil), o.Fields...)
+	for _, mp := range o.Maps {
+		fields = append(fields, mp.Field)
+	}
+	for _, f := range fields {
+		if name, ok := fieldIDs[f.ID]; ok {
+			m.conflict(path, `field ID %d is used by both "%s" and "%s"`, f.ID, name, f.Name)
+		}
+		fieldIDs[f.ID] = f.Name
+		if reservedIDs[f.ID] {
+			m.conflict(joinPath(path, f.Name), "field ID %d is reserved", f.ID)
+		}
+		if reservedNames[f.Name] {
+			m.conflict(joinPath(path, f.Name), "field name is reserved")
+		}
+	}
+
+	return o
+}
+
+func (m *merger) mergeEnum(path string, b *Enum, o, t Enum) Enum {
+	if b == nil {
+		b = &Enum{}
+	}
+
+	o.AllowAlias = mergeValue(m, path, "allow_alias", b.AllowAlias, o.AllowAlias, t.AllowAlias)
+	o.Options = m.mergeOptions(path, b.Options, o.Options, t.Options)
+	o.ReservedIDs = mergeSet(b.ReservedIDs, o.ReservedIDs, t.ReservedIDs)
+	o.ReservedNames = mergeSet(b.ReservedNames, o.ReservedNames, t.ReservedNames)
+	o.EnumFields = mergeList(m, path, b.EnumFields, o.EnumFields, t.EnumFields,
+		func(f EnumField) string { return f.Name }, nil,
+	)
+
+	reservedIDs, reservedNames := set(o.ReservedIDs), set(o.ReservedNames)
+	values := make(map[int]string)
+	for _, f := range o.EnumFields {
+		if name, ok := values[f.Integer]; ok && !o.AllowAlias {
+			m.conflict(path, `value %d is used by both "%s" and "%s"`, f.Integer, name, f.Name)
+		}
+		values[f.Integer] = f.Name
+		if reservedIDs[f.Integer] {
+			m.conflict(joinPath(path, f.Name), "value %d is reserved", f.Integer)
+		}
+		if reservedNames[f.Name] {
+			m.conflict(joinPath(path, f.Name), "value name is reserved")
+		}
+	}
+
+	return o
+}
+
+func (m *merger) mergeService(path string, b *Service, o, t Service) Service {
+	if b == nil {
+		b = &Service{}
+	}
+
+	o.RPCs = mergeList(m, path, b.RPCs, o.RPCs, t.RPCs,
+		func(rpc RPC) string { return rpc.Name }, nil,
+	)
+
+	return o
+}
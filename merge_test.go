@@ -0,0 +1,218 @@
+package protolock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mergeBaseProto = `syntax = "proto3";
+package test;
+
+message Channel {
+  int64 id = 1;
+  string name = 2;
+  reserved 9;
+}
+
+enum Kind {
+  UNKNOWN = 0;
+}
+
+service ChannelChanger {
+  rpc Next(Channel) returns (Channel);
+}
+`
+
+const mergeOursProto = `syntax = "proto3";
+package test;
+
+message Channel {
+  int64 id = 1;
+  string name = 2;
+  string description = 3;
+  reserved 9;
+}
+
+enum Kind {
+  UNKNOWN = 0;
+  PUBLIC = 1;
+}
+
+service ChannelChanger {
+  rpc Next(Channel) returns (Channel);
+}
+`
+
+const mergeTheirsProto = `syntax = "proto3";
+package test;
+
+message Channel {
+  int64 id = 1;
+  string name = 2;
+  bool archived = 4;
+  reserved 9, 10;
+}
+
+enum Kind {
+  UNKNOWN = 0;
+}
+
+service ChannelChanger {
+  rpc Next(Channel) returns (Channel);
+  rpc Previous(Channel) returns (Channel);
+}
+`
+
+func TestMerge(t *testing.T) {
+	base := parseTestProto(t, mergeBaseProto)
+	ours := parseTestProto(t, mergeOursProto)
+	theirs := parseTestProto(t, mergeTheirsProto)
+
+	// theirs also adds a file, defining the same names in another package path
+	added := parseTestProto(t, simpleProto)
+	added.Definitions[0].Filepath = "other.proto"
+	theirs.Definitions = append(theirs.Definitions, added.Definitions...)
+
+	merged, err := Merge(base, ours, theirs)
+	require.NoError(t, err)
+	assert.Equal(t, LockVersion, merged.Version)
+	require.Len(t, merged.Definitions, 2)
+
+	x := NewIndex(*merged)
+	channel, ok := x.Message("test.Channel")
+	require.True(t, ok)
+	for _, name := range []string{"id", "name", "description", "archived"} {
+		_, ok := channel.FieldByName(name)
+		assert.True(t, ok, name)
+	}
+	assert.ElementsMatch(t, []int{9, 10}, channel.Message.ReservedIDs)
+
+	kind, ok := x.Enum("test.Kind")
+	require.True(t, ok)
+	_, ok = kind.ValueByName("PUBLIC")
+	assert.True(t, ok)
+
+	svc, ok := x.Service("test.ChannelChanger")
+	require.True(t, ok)
+	_, ok = svc.RPC("Previous")
+	assert.True(t, ok)
+
+	// merging is symmetric, apart from order
+	reversed, err := Merge(base, theirs, ours)
+	require.NoError(t, err)
+	assert.True(t, merged.Equal(reversed))
+
+	// unchanged sides merge to the other side
+	merged, err = Merge(base, base, ours)
+	require.NoError(t, err)
+	assert.True(t, merged.Equal(&ours))
+}
+
+func TestMergeConflicts(t *testing.T) {
+	base := parseTestProto(t, mergeBaseProto)
+	ours := parseTestProto(t, mergeOursProto)
+
+	// a different field with the same ID
+	theirs := parseTestProto(t, mergeBaseProto)
+	fields := &theirs.Definitions[0].Def.Messages[0].Fields
+	*fields = append(*fields, Field{ID: 3, Name: "topic", Type: "string"})
+
+	_, err := Merge(base, ours, theirs)
+	assert.True(t, errors.Is(err, ErrMergeConflict))
+	var mergeErr *MergeError
+	require.True(t, errors.As(err, &mergeErr))
+	require.Len(t, mergeErr.Conflicts, 1)
+	assert.Equal(t, Protopath("memory/io.Reader"), mergeErr.Conflicts[0].Filepath)
+	assert.Equal(t, "Channel", mergeErr.Conflicts[0].EntityPath)
+	assert.Contains(t, err.Error(), `field ID 3 is used by both "description" and "topic"`)
+
+	// the same field changed differently
+	theirs = parseTestProto(t, mergeOursProto)
+	theirs.Definitions[0].Def.Messages[0].Fields[2].Type = "bytes"
+	_, err = Merge(base, ours, theirs)
+	require.True(t, errors.As(err, &mergeErr))
+	assert.Equal(t, "Channel.description", mergeErr.Conflicts[0].EntityPath)
+
+	// a field which reuses an ID reserved by the other side
+	theirs = parseTestProto(t, mergeBaseProto)
+	theirs.Definitions[0].Def.Messages[0].ReservedIDs = []int{3, 9}
+	_, err = Merge(base, ours, theirs)
+	require.True(t, errors.As(err, &mergeErr))
+	assert.Equal(t, "Channel.description", mergeErr.Conflicts[0].EntityPath)
+	assert.Equal(t, "field ID 3 is reserved", mergeErr.Conflicts[0].Message)
+
+	// a file changed by ours and removed by theirs
+	_, err = Merge(base, ours, Protolock{})
+	require.True(t, errors.As(err, &mergeErr))
+	assert.Equal(t, Protopath("memory/io.Reader"), mergeErr.Conflicts[0].Filepath)
+	assert.Equal(t, "", mergeErr.Conflicts[0].EntityPath)
+}
+
+func TestMergeOptions(t *testing.T) {
+	base := parseTestProto(t, `syntax = "proto3";
+package test;
+
+option go_package = "example.com/test";
+
+message Channel {
+  option deprecated = false;
+  int64 id = 1;
+}
+`)
+	ours := parseTestProto(t, `syntax = "proto3";
+package test;
+
+option go_package = "example.com/test/v2";
+
+message Channel {
+  option deprecated = false;
+  option (owner) = "ours";
+  int64 id = 1;
+}
+`)
+	theirs := parseTestProto(t, `syntax = "proto3";
+package test;
+
+option go_package = "example.com/test";
+option java_package = "com.example.test";
+
+message Channel {
+  option deprecated = true;
+  int64 id = 1;
+}
+`)
+
+	// options changed or added by different sides are merged by name
+	merged, err := Merge(base, ours, theirs)
+	require.NoError(t, err)
+
+	entry := merged.Definitions[0].Def
+	fileOpts := make(map[string]string)
+	for _, opt := range entry.Options {
+		fileOpts[opt.Name] = opt.Value
+	}
+	assert.Equal(t, map[string]string{
+		"go_package":   "example.com/test/v2",
+		"java_package": "com.example.test",
+	}, fileOpts)
+
+	msgOpts := make(map[string]string)
+	for _, opt := range entry.Messages[0].Options {
+		msgOpts[opt.Name] = opt.Value
+	}
+	assert.Equal(t, map[string]string{
+		"deprecated": "true",
+		"(owner)":    "ours",
+	}, msgOpts)
+
+	// the same option changed differently on both sides conflicts
+	theirs.Definitions[0].Def.Options[0].Value = "example.com/test/v3"
+	_, err = Merge(base, ours, theirs)
+	var mergeErr *MergeError
+	require.True(t, errors.As(err, &mergeErr))
+	require.Len(t, mergeErr.Conflicts, 1)
+	assert.Equal(t, "go_package", mergeErr.Conflicts[0].EntityPath)
+}
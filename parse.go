@@ -2,14 +2,12 @@ package protolock
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
-	"strings"
-	"sync"
+	"strconv"
 
 	"github.com/emicklei/proto"
 )
@@ -17,6 +15,9 @@ import (
 const LockFileName = "proto.lock"
 
 type Protolock struct {
+	// Version is the format version of the proto.lock file, see LockVersion.
+	// Files written before the format was versioned have no version.
+	Version     int          `json:"version,omitempty"`
 	Definitions []Definition `json:"definitions,omitempty"`
 }
 
@@ -26,6 +27,9 @@ type Definition struct {
 }
 
 type Entry struct {
+	// Syntax is the syntax of the file, e.g. "proto3", which is empty in
+	// locks written before it was recorded.
+	Syntax   string    `json:"syntax,omitempty"`
 	Enums    []Enum    `json:"enums,omitempty"`
 	Messages []Message `json:"messages,omitempty"`
 	Services []Service `json:"services,omitempty"`
@@ -115,6 +119,34 @@ type Warning struct {
 	Filepath Protopath `json:"filepath,omitempty"`
 	Message  string    `json:"message,omitempty"`
 	RuleName string    `json:"rulename,omitempty"`
+	// Severity defaults to SeverityError when empty.
+	Severity Severity `json:"severity,omitempty"`
+	// EntityPath is the fully-qualified name of the entity the warning is
+	// about, e.g. "test.Channel.name".
+	EntityPath string `json:"entity_path,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	Fix        *Fix   `json:"fix,omitempty"`
+}
+
+// Severity indicates how serious a Warning is.
+type Severity string
+
+const (
+	// SeverityError is a breaking change, and fails the status check.
+	SeverityError Severity = "error"
+	// SeverityWarning is a risky change, which is reported but does not
+	// fail the status check.
+	SeverityWarning Severity = "warning"
+	// SeverityInfo is informational, and does not fail the status check.
+	SeverityInfo Severity = "info"
+)
+
+// Fix is a suggested change which would resolve a Warning.
+type Fix struct {
+	Description string `json:"description,omitempty"`
+	// Replacement is the suggested source text, if any.
+	Replacement string `json:"replacement,omitempty"`
 }
 
 type ProtoFile struct {
@@ -129,6 +161,7 @@ var (
 	imps  []Import
 	pkg   Package
 	opts  []Option
+	stx   string
 
 	ErrWarningsFound = errors.New("comparison found one or more warnings")
 )
@@ -146,6 +179,7 @@ func Parse(filename string, r io.Reader) (Entry, error) {
 	svcs = []Service{}
 	imps = []Import{}
 	opts = []Option{}
+	stx = ""
 
 	proto.Walk(
 		def,
@@ -154,10 +188,12 @@ func Parse(filename string, r io.Reader) (Entry, error) {
 		proto.WithMessage(withMessage),
 		protoWithImport(withImport),
 		protoWithPackage(withPackage),
+		protoWithSyntax(withSyntax),
 		proto.WithOption(withOption),
 	)
 
 	return Entry{
+		Syntax:   stx,
 		Enums:    enums,
 		Messages: msgs,
 		Services: svcs,
@@ -201,20 +237,17 @@ func parseEnum(e *proto.Enum) Enum {
 			}
 			for _, ee := range ef.Elements {
 				if o, ok := ee.(*proto.Option); ok {
-					field.Options = append(field.Options, Option{
-						Name:  o.Name,
-						Value: o.Constant.Source,
-					})
+					field.Options = append(field.Options, parseOption(o))
 				}
 			}
 			enum.EnumFields = append(enum.EnumFields, field)
 		}
 
 		if o, ok := v.(*proto.Option); ok {
-			enum.Options = append(enum.Options, Option{
-				Name:  o.Name,
-				Value: o.Constant.Source,
-			})
+			if o.Name == "allow_alias" {
+				enum.AllowAlias, _ = strconv.ParseBool(o.Constant.Source)
+			}
+			enum.Options = append(enum.Options, parseOption(o))
 		}
 
 		if r, ok := v.(*proto.Reserved); ok {
@@ -448,17 +481,22 @@ func withPackage(im *proto.Package) {
 	}
 }
 
-// openLockFile opens and returns the lock file on disk for reading.
-func openLockFile(cfg Config) (io.ReadCloser, error) {
-	f, err := os.Open(cfg.LockFilePath())
-	if err != nil {
-		return nil, err
+func protoWithSyntax(apply func(s *proto.Syntax)) proto.Handler {
+	return func(v proto.Visitee) {
+		if s, ok := v.(*proto.Syntax); ok {
+			apply(s)
+		}
 	}
+}
 
-	return f, nil
+func withSyntax(s *proto.Syntax) {
+	stx = s.Value
 }
 
-// FromReader unmarshals a proto.lock file into a Protolock struct.
+// FromReader unmarshals a proto.lock file into a Protolock struct. Files in an
+// older format are upgraded to the current LockVersion, and
+// ErrUnsupportedLockVersion is returned for files in a newer format. The
+// shards of a sharded LockLayout are separate files, see ReadLock.
 func FromReader(r io.Reader) (Protolock, error) {
 	buf := bytes.Buffer{}
 	_, err := io.Copy(&buf, r)
@@ -472,6 +510,11 @@ func FromReader(r io.Reader) (Protolock, error) {
 		return Protolock{}, err
 	}
 
+	err = migrateLock(&lock)
+	if err != nil {
+		return Protolock{}, err
+	}
+
 	return lock, nil
 }
 
@@ -479,149 +522,18 @@ func FromReader(r io.Reader) (Protolock, error) {
 // one or more warnings to report to the caller. If no error is returned, the
 // Report can be ignored.
 func Compare(current, update Protolock) (*Report, error) {
-	var warnings []Warning
-	var wg sync.WaitGroup
-	report := &Report{
-		Current: current,
-		Updated: update,
-	}
-	for _, rule := range Rules {
-		wg.Add(1)
-		go func() {
-			if debug {
-				beginRuleDebug(rule.Name)
-			}
-			_warnings, _ := rule.Func(current, update)
-			for i := range _warnings {
-				_warnings[i].RuleName = rule.Name
-			}
-			if debug {
-				concludeRuleDebug(rule.Name, _warnings)
-			}
-
-			warnings = append(warnings, _warnings...)
-			wg.Done()
-		}()
-		wg.Wait()
-	}
-	report.Warnings = warnings
-
-	if len(report.Warnings) != 0 {
-		return report, ErrWarningsFound
-	}
-
-	return report, nil
+	return defaultEngine().Compare(current, update)
 }
 
-// getProtoFiles finds recursively all .proto files to be processed.
-func getProtoFiles(root string, ignores string) ([]string, error) {
-	protoFiles := []string{}
-
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// if not a .proto file, do not attempt to parse.
-		if !strings.HasSuffix(info.Name(), protoSuffix) {
-			return nil
-		}
-
-		// skip to next if is a directory
-		if info.IsDir() {
-			return nil
-		}
-
-		// skip if path is within an ignored path
-		if ignores != "" {
-			for _, ignore := range strings.Split(ignores, ",") {
-				rel, err := filepath.Rel(filepath.Join(root, ignore), path)
-				if err != nil {
-					return nil
-				}
-
-				if !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
-					return nil
-				}
-			}
-		}
-
-		protoFiles = append(protoFiles, path)
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return protoFiles, nil
-}
-
-// getUpdatedLock finds all .proto files recursively in tree, parse each file
-// and accumulate all definitions into an updated Protolock.
-func getUpdatedLock(cfg Config) (*Protolock, error) {
-	// files is a slice of struct `ProtoFile` to be joined into the proto.lock file.
-	var files []ProtoFile
-
-	root, err := filepath.Abs(cfg.ProtoRoot)
-	if err != nil {
-		return nil, err
-	}
-
-	protoFiles, err := getProtoFiles(root, cfg.Ignore)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, path := range protoFiles {
-		f, err := os.Open(path)
-		if err != nil {
-			return nil, err
-		}
-
-		// Have the parser report the file path
-		friendlyPath := path
-		cwd, err := os.Getwd()
-		if err == nil {
-			relpath, err := filepath.Rel(cwd, path)
-			if err == nil {
-				friendlyPath = relpath
-			}
-		}
-		entry, err := Parse(friendlyPath, f)
-		if err != nil {
-			printIfErr(f.Close())
-			return nil, err
-		}
-
-		localPath := strings.TrimPrefix(path, root)
-		localPath = strings.TrimPrefix(localPath, string(filepath.Separator))
-		protoFile := ProtoFile{
-			ProtoPath: ProtoPath(Protopath(localPath)),
-			Entry:     entry,
-		}
-		files = append(files, protoFile)
-
-		// manually close the file to prevent `too many open files` error
-		printIfErr(f.Close())
-	}
-
-	// add all the definitions from the updated set of protos to a Protolock
-	// used for analysis and comparison against the current Protolock, saved
-	// as the proto.lock file in the current directory
-	var updated Protolock
-	for _, file := range files {
-		updated.Definitions = append(updated.Definitions, Definition{
-			Filepath: file.ProtoPath,
-			Def:      file.Entry,
-		})
-	}
-
-	return &updated, nil
+// getUpdatedLock finds all .proto files recursively in the tracked proto
+// roots, parse each file and accumulate all definitions into an updated
+// Protolock.
+func getUpdatedLock(ctx context.Context, cfg Config) (*Protolock, error) {
+	return buildRoots(ctx, cfg)
 }
 
 func printIfErr(err error) {
 	if err != nil {
-		fmt.Printf("protolock: %v\n", err)
+		logger.Printf("protolock: %v\n", err)
 	}
 }
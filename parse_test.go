@@ -1,6 +1,7 @@
 package protolock
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -263,6 +264,19 @@ func TestParseIncludingPackage(t *testing.T) {
 	assert.Equal(t, "test", entry.Package.Name)
 }
 
+func TestParseSyntax(t *testing.T) {
+	entry, err := Parse("test:protoWithPackages", strings.NewReader(protoWithPackages))
+	assert.NoError(t, err)
+	assert.Equal(t, "proto3", entry.Syntax)
+
+	entry, err = Parse(
+		"test:protoWithRequiredAndOptionalFields",
+		strings.NewReader(protoWithRequiredAndOptionalFields),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "proto2", entry.Syntax)
+}
+
 func TestParseIncludingMessageOptions(t *testing.T) {
 	r := strings.NewReader(protoWithMessageOptions)
 
@@ -370,6 +384,7 @@ func TestParseIncludingEnumFieldOptions(t *testing.T) {
 	assert.Len(t, entry.Enums[0].EnumFields[2].Options, 1)
 	assert.Equal(t, "(my_enum_value_option)", entry.Enums[0].EnumFields[2].Options[0].Name)
 	assert.Equal(t, "321", entry.Enums[0].EnumFields[2].Options[0].Value)
+	assert.True(t, entry.Enums[0].AllowAlias)
 }
 
 func TestParseIncludingEnumOptions(t *testing.T) {
@@ -383,6 +398,7 @@ func TestParseIncludingEnumOptions(t *testing.T) {
 	assert.Equal(t, entry.Enums[0].Options[0].Value, "true")
 	assert.Equal(t, entry.Enums[0].Options[1].Name, "(custom_enum_option)")
 	assert.Equal(t, entry.Enums[0].Options[1].Value, "123")
+	assert.False(t, entry.Enums[0].AllowAlias)
 	assert.Equal(t, entry.Enums[1].Name, "TestNestedEnumOption.NestedEnum")
 	assert.Len(t, entry.Enums[1].Options, 1)
 	assert.Equal(t, entry.Enums[1].Options[0].Name, "(enum_option)")
@@ -453,62 +469,62 @@ func TestParseWithOneof(t *testing.T) {
 }
 
 func TestGetProtoFilesFiltersDirectories(t *testing.T) {
-	files, err := getProtoFiles(gpfPath, "")
+	files, err := getProtoFilesFS(os.DirFS(gpfPath), "")
 	require.NoError(t, err)
 
-	path := filepath.Join(gpfPath, "directory.proto")
+	path := "directory.proto"
 	assert.NotContains(t, files, path)
 
-	path = filepath.Join(gpfPath, "include", "include.proto")
+	path = "include/include.proto"
 	assert.Contains(t, files, path)
 }
 
 func TestGetProtoFilesFiltersNonProto(t *testing.T) {
-	files, err := getProtoFiles(gpfPath, "")
+	files, err := getProtoFilesFS(os.DirFS(gpfPath), "")
 	require.NoError(t, err)
 
-	path := filepath.Join(gpfPath, "directory.proto", "test.non-proto")
+	path := "directory.proto/test.non-proto"
 	assert.NotContains(t, files, path)
 
-	path = filepath.Join(gpfPath, "include", "include.proto")
+	path = "include/include.proto"
 	assert.Contains(t, files, path)
 }
 
 func TestGetProtoFilesIgnoresDirectories(t *testing.T) {
-	files, err := getProtoFiles(gpfPath, "exclude")
+	files, err := getProtoFilesFS(os.DirFS(gpfPath), "exclude")
 	require.NoError(t, err)
 
-	path := filepath.Join(gpfPath, "exclude", "test.proto")
+	path := "exclude/test.proto"
 	assert.NotContains(t, files, path)
 
-	path = filepath.Join(gpfPath, "include", "include.proto")
+	path = "include/include.proto"
 	assert.Contains(t, files, path)
 }
 
 func TestGetProtoFilesIgnoresFiles(t *testing.T) {
-	files, err := getProtoFiles(gpfPath, filepath.Join("include", "exclude.proto"))
+	files, err := getProtoFilesFS(os.DirFS(gpfPath), filepath.Join("include", "exclude.proto"))
 	require.NoError(t, err)
 
-	path := filepath.Join(gpfPath, "include", "exclude.proto")
+	path := "include/exclude.proto"
 	assert.NotContains(t, files, path)
 
-	path = filepath.Join(gpfPath, "include", "include.proto")
+	path = "include/include.proto"
 	assert.Contains(t, files, path)
 }
 
 func TestGetProtoFilesIgnoresMultiple(t *testing.T) {
 	paths := []string{"exclude", filepath.Join("include", "exclude.proto")}
 	ignores := strings.Join(paths, ",")
-	files, err := getProtoFiles(gpfPath, ignores)
+	files, err := getProtoFilesFS(os.DirFS(gpfPath), ignores)
 	require.NoError(t, err)
 
-	path := filepath.Join(gpfPath, "exclude", "test.proto")
+	path := "exclude/test.proto"
 	assert.NotContains(t, files, path)
 
-	path = filepath.Join(gpfPath, "include", "exclude.proto")
+	path = "include/exclude.proto"
 	assert.NotContains(t, files, path)
 
-	path = filepath.Join(gpfPath, "include", "include.proto")
+	path = "include/include.proto"
 	assert.Contains(t, files, path)
 }
 
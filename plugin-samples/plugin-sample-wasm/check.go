@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/nilslice/protolock"
+	"github.com/nilslice/protolock/extend"
+)
+
+// check is the plugin implementation, shared by the WASM module (see main.go)
+// and the native binary (see native.go).
+func check(data *extend.Data) *extend.Data {
+	// with the `extend.Data` available, you would do some checks on the current and updated set of
+	// `proto.lock` representations. Here we are adding a warning to demonstrate that the plugin
+	// works with some known data output to verify.
+	warning := protolock.Warning{
+		Filepath: "fake.proto",
+		Message:  "An Extism plugin ran and checked the status of the proto.lock files",
+		RuleName: "RuleNameXYZ",
+	}
+	data.PluginWarnings = append(data.PluginWarnings, warning)
+
+	return data
+}
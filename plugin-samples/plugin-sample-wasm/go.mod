@@ -1,9 +1,12 @@
 module github.com/nilslice/protolock/plugin-samples/plugin-sample-wasm
 
-go 1.21
+go 1.24.0
+
+require github.com/nilslice/protolock v0.17.0
 
 require (
-	github.com/emicklei/proto v1.9.1 // indirect
+	github.com/emicklei/proto v1.13.2 // indirect
 	github.com/extism/go-pdk v1.0.0 // indirect
-	github.com/nilslice/protolock v0.17.0 // indirect
 )
+
+replace github.com/nilslice/protolock => ../../
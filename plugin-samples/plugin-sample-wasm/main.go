@@ -1,54 +1,40 @@
+//go:build wasm
+
 package main
 
 import (
-	"encoding/json"
-
-	pdk "github.com/extism/go-pdk"
-	"github.com/nilslice/protolock"
-	"github.com/nilslice/protolock/extend"
+	"github.com/nilslice/protolock/extend/wasm"
 )
 
 // an Extism plugin uses a 'PDK' to communicate data input and output from its host system, in
-// this case, the `protolock` command.
+// this case, the `protolock` command. The `extend/wasm` package wraps the PDK, so that the same
+// `extend.PluginFunc` can be used by both WASM and native plugins.
 
 // see https://extism.org and https://github.com/extism/extism for more information.
 
-// In order to satisfy the current usage, an Extism Protolock plugin must export a single function
+// status.wasm is built from this directory using Go 1.24 or later:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -trimpath -ldflags="-s -w" -o status.wasm
+
+var plugin = wasm.NewPlugin("sample-wasm")
+
+// In order to satisfy the current usage, an Extism Protolock plugin must export a function
 // "status" with the following signature:
 
-//export status
+//go:wasmexport status
 func status() int32 {
 	// rather than taking input from stdin, like native Protolock plugins, Extism plugins take data
-	// from their host, using the `pdk.Input()` function, returning bytes from protolock.
-	var data extend.Data
-	err := json.Unmarshal(pdk.Input(), &data.Current)
-	if err != nil {
-		pdk.SetError(err)
-		return 1
-	}
-
-	// with the `extend.Data` available, you would do some checks on the current and updated set of
-	// `proto.lock` representations. Here we are adding a warning to demonstrate that the plugin
-	// works with some known data output to verify.
-	warning := protolock.Warning{
-		Filepath: "fake.proto",
-		Message:  "An Extism plugin ran and checked the status of the proto.lock files",
-		RuleName: "RuleNameXYZ",
-	}
-	data.PluginWarnings = append(data.PluginWarnings, warning)
-
-	b, err := json.Marshal(data)
-	if err != nil {
-		pdk.SetError(err)
-		return 1
-	}
-
-	// tather than writing data to stdout, like native Protolock plugins, Extism plugins provide
-	// data back to their host, using the `pdk.Output()` function, returning bytes to protolock.
-	pdk.Output(b)
-
-	// non-zero return code here will result in Extism detecting an error.
-	return 0
+	// from their host, and provide data back to their host. A non-zero return code here will result
+	// in Extism detecting an error.
+	return plugin.Run(check)
+}
+
+// Optionally, a plugin may export a "handshake" function, which protolock calls to check that
+// the plugin is compatible before sending it any data.
+
+//go:wasmexport handshake
+func handshake() int32 {
+	return plugin.RunHandshake()
 }
 
 // this Go code is compiled to WebAssembly, and current compilers expect some entrypoint, even if
@@ -0,0 +1,13 @@
+//go:build !wasm
+
+package main
+
+import (
+	"github.com/nilslice/protolock/extend"
+)
+
+// when compiled for any non-WASM target, the same plugin is built as a native binary, which reads
+// its input from stdin and writes its output to stdout.
+func main() {
+	extend.NewPlugin("sample-wasm").Init(check)
+}
@@ -0,0 +1,75 @@
+package protolock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile is a compatibility guarantee which a set of rules protects.
+type Profile string
+
+const (
+	// ProfileWire protects consumers of the binary wire format, e.g. gRPC
+	// services and clients.
+	ProfileWire Profile = "wire"
+
+	// ProfileJSON protects consumers of the canonical JSON mapping.
+	ProfileJSON Profile = "json"
+
+	// ProfileSource protects consumers of generated code, e.g. a Go SDK.
+	ProfileSource Profile = "source"
+)
+
+var (
+	// Profiles lists all known compatibility profiles.
+	Profiles = []Profile{ProfileWire, ProfileJSON, ProfileSource}
+
+	// allProfiles is used by rules which protect every profile.
+	allProfiles = Profiles
+)
+
+// ParseProfile returns the Profile named by s, or an error if s is not the
+// name of a known profile. An empty string returns the empty Profile, which
+// selects all rules.
+func ParseProfile(s string) (Profile, error) {
+	if s == "" {
+		return "", nil
+	}
+
+	for _, p := range Profiles {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+
+	var names []string
+	for _, p := range Profiles {
+		names = append(names, string(p))
+	}
+	return "", fmt.Errorf(
+		"unknown profile: %q, must be one of: %s",
+		s, strings.Join(names, ", "),
+	)
+}
+
+// SetProfile enables the user to select which compatibility profile is
+// enforced by the default Engine. Only rules which protect the profile are run
+// by Compare. The empty Profile runs all rules.
+func SetProfile(p Profile) {
+	std.Profile = p
+}
+
+// Protects reports whether the Rule protects the provided Profile. Every rule
+// protects the empty Profile.
+func (r Rule) Protects(p Profile) bool {
+	if p == "" {
+		return true
+	}
+
+	for _, rp := range r.Profiles {
+		if rp == p {
+			return true
+		}
+	}
+	return false
+}
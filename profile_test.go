@@ -0,0 +1,52 @@
+package protolock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProfile(t *testing.T) {
+	for _, p := range Profiles {
+		parsed, err := ParseProfile(string(p))
+		assert.NoError(t, err)
+		assert.Equal(t, p, parsed)
+	}
+
+	parsed, err := ParseProfile("")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile(""), parsed)
+
+	_, err = ParseProfile("binary")
+	assert.Error(t, err)
+}
+
+func TestCompareWithProfile(t *testing.T) {
+	curLock := parseTestProto(t, noChangingFieldNamesProto)
+	updLock := parseTestProto(t, changingFieldNamesProto)
+	defer SetProfile("")
+
+	hasRule := func(warnings []Warning, name string) bool {
+		for _, w := range warnings {
+			if w.RuleName == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	report, err := Compare(curLock, updLock)
+	assert.Equal(t, ErrWarningsFound, err)
+	assert.True(t, hasRule(report.Warnings, "NoChangingFieldNames"))
+
+	SetProfile(ProfileWire)
+	report, err = Compare(curLock, updLock)
+	assert.Equal(t, ErrWarningsFound, err)
+	assert.False(t, hasRule(report.Warnings, "NoChangingFieldNames"))
+	assert.True(t, hasRule(report.Warnings, "NoRemovingFieldsWithoutReserve"))
+
+	SetProfile(ProfileJSON)
+	report, err = Compare(curLock, updLock)
+	assert.Equal(t, ErrWarningsFound, err)
+	assert.True(t, hasRule(report.Warnings, "NoChangingFieldNames"))
+}
@@ -0,0 +1,46 @@
+package protolock
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidRule indicates that a Rule cannot be registered.
+var ErrInvalidRule = errors.New("invalid rule")
+
+// RegisterRule adds a Rule to the Rules run by Compare, enabling programs to
+// enforce their own rules alongside the built-in ones. A Rule without
+// Profiles protects every profile. An error is returned if the Rule has no
+// name, has neither a Func nor an IndexFunc, or if a Rule with the same name
+// is already registered.
+func RegisterRule(rule Rule) error {
+	return registerRule(&Rules, rule)
+}
+
+func registerRule(rules *[]Rule, rule Rule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("%w: rule name is required", ErrInvalidRule)
+	}
+
+	if rule.Func == nil && rule.IndexFunc == nil {
+		return fmt.Errorf("%w: %q has no rule func", ErrInvalidRule, rule.Name)
+	}
+	if rule.Func == nil {
+		rule.Func = WithIndex(rule.IndexFunc)
+	}
+
+	for _, r := range *rules {
+		if r.Name == rule.Name {
+			return fmt.Errorf(
+				"%w: %q is already registered", ErrInvalidRule, rule.Name,
+			)
+		}
+	}
+
+	if len(rule.Profiles) == 0 {
+		rule.Profiles = allProfiles
+	}
+
+	*rules = append(*rules, rule)
+	return nil
+}
@@ -0,0 +1,44 @@
+package protolock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterRule(t *testing.T) {
+	builtin := Rules
+	defer func() { Rules = builtin }()
+	Rules = append([]Rule(nil), builtin...)
+
+	rule := Rule{
+		Name:        "NoChangingAnything",
+		Description: "Nothing may change.",
+		Func: func(current, updated Protolock) ([]Warning, bool) {
+			if current.Equal(&updated) {
+				return nil, true
+			}
+			return []Warning{{Message: "something changed"}}, false
+		},
+	}
+	assert.NoError(t, RegisterRule(rule))
+	assert.Len(t, Rules, len(builtin)+1)
+	assert.Equal(t, allProfiles, Rules[len(Rules)-1].Profiles)
+
+	curLock := parseTestProto(t, simpleProto)
+	updLock := parseTestProto(t, noUsingReservedFieldsProto)
+	report, err := Compare(curLock, updLock)
+	assert.Equal(t, ErrWarningsFound, err)
+
+	var found bool
+	for _, w := range report.Warnings {
+		if w.RuleName == rule.Name {
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	assert.ErrorIs(t, RegisterRule(rule), ErrInvalidRule)
+	assert.ErrorIs(t, RegisterRule(Rule{Func: rule.Func}), ErrInvalidRule)
+	assert.ErrorIs(t, RegisterRule(Rule{Name: "NoFunc"}), ErrInvalidRule)
+}
@@ -7,25 +7,70 @@ import (
 )
 
 // HandleReport checks a report for warnigs and writes warnings to an io.Writer.
-// The returned int (an exit code) is 1 if warnings are encountered.
+// The returned int (an exit code) is 1 if warnings with SeverityError (or no
+// severity) are encountered.
 func HandleReport(report *Report, w io.Writer, err error) (int, error) {
 	if len(report.Warnings) > 0 {
 		// sort the warnings so they are grouped by file location
 		orderByPathAndMessage(report.Warnings)
 
+		code := 0
 		for _, warning := range report.Warnings {
+			if warning.IsError() {
+				code = 1
+			}
+
 			fmt.Fprintf(
 				w,
-				"CONFLICT: %s [%s]\n",
-				warning.Message, warning.Filepath,
+				"%s: %s [%s]%s\n",
+				warning.label(), warning.Message, warning.location(),
+				warning.entity(),
 			)
+			if warning.Fix != nil && warning.Fix.Description != "" {
+				fmt.Fprintf(w, "\tfix: %s\n", warning.Fix.Description)
+			}
 		}
-		return 1, err
+		return code, err
 	}
 
 	return 0, err
 }
 
+// IsError reports whether the Warning has SeverityError, which is the default
+// when no severity is set.
+func (w Warning) IsError() bool {
+	return w.Severity == "" || w.Severity == SeverityError
+}
+
+func (w Warning) label() string {
+	switch w.Severity {
+	case SeverityWarning:
+		return "WARNING"
+	case SeverityInfo:
+		return "INFO"
+	default:
+		return "CONFLICT"
+	}
+}
+
+func (w Warning) location() string {
+	switch {
+	case w.Line > 0 && w.Column > 0:
+		return fmt.Sprintf("%s:%d:%d", w.Filepath, w.Line, w.Column)
+	case w.Line > 0:
+		return fmt.Sprintf("%s:%d", w.Filepath, w.Line)
+	default:
+		return string(w.Filepath)
+	}
+}
+
+func (w Warning) entity() string {
+	if w.EntityPath == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", w.EntityPath)
+}
+
 func orderByPathAndMessage(warnings []Warning) {
 	sort.Slice(warnings, func(i, j int) bool {
 		if warnings[i].Filepath < warnings[j].Filepath {
@@ -34,6 +79,9 @@ func orderByPathAndMessage(warnings []Warning) {
 		if warnings[i].Filepath > warnings[j].Filepath {
 			return false
 		}
+		if warnings[i].Line != warnings[j].Line {
+			return warnings[i].Line < warnings[j].Line
+		}
 		return warnings[i].Message < warnings[j].Message
 	})
 }
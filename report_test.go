@@ -0,0 +1,108 @@
+package protolock
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleReport(t *testing.T) {
+	report := &Report{
+		Warnings: []Warning{
+			{
+				Filepath: "b.proto",
+				Message:  "a breaking change",
+			},
+			{
+				Filepath:   "a.proto",
+				Message:    "a risky change",
+				Severity:   SeverityWarning,
+				EntityPath: "test.Channel.name",
+				Line:       12,
+				Column:     3,
+				Fix:        &Fix{Description: "reserve the field name"},
+			},
+			{
+				Filepath: "a.proto",
+				Message:  "something to know",
+				Severity: SeverityInfo,
+				Line:     4,
+			},
+		},
+	}
+
+	w := &bytes.Buffer{}
+	code, err := HandleReport(report, w, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, `INFO: something to know [a.proto:4]
+WARNING: a risky change [a.proto:12:3] (test.Channel.name)
+	fix: reserve the field name
+CONFLICT: a breaking change [b.proto]
+`, w.String())
+
+	// only warnings with error severity produce a non-zero exit code
+	report.Warnings = report.Warnings[:2]
+	report.Warnings[1].Severity = SeverityWarning
+	report.Warnings[0].Severity = SeverityInfo
+	code, err = HandleReport(report, &bytes.Buffer{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+}
+
+func TestHandleReportBuiltinSeverity(t *testing.T) {
+	curLock := parseTestProto(t, `syntax = "proto3";
+package test;
+
+enum Status {
+  option allow_alias = true;
+  UNKNOWN = 0;
+  STARTED = 1;
+  RUNNING = 1;
+}
+
+message Channel {
+  int32 id = 1;
+}
+`)
+	updLock := parseTestProto(t, `syntax = "proto3";
+package test;
+
+enum Status {
+  option allow_alias = true;
+  UNKNOWN = 0;
+  RUNNING = 1;
+  STARTED = 1;
+}
+
+message Channel {
+  int64 id = 1;
+}
+`)
+
+	// with the default profile, the wire-compatible type change is an error,
+	// while the new primary enum name is a warning
+	report, err := NewEngine(EngineOptions{Strict: true}).Compare(curLock, updLock)
+	assert.Equal(t, ErrWarningsFound, err)
+
+	w := &bytes.Buffer{}
+	code, err := HandleReport(report, w, err)
+	assert.Equal(t, ErrWarningsFound, err)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, `CONFLICT: "Channel" field: "id" has a different type: int64, previously int32 (wire-compatible, but values may be truncated or reinterpreted) [memory/io.Reader]
+WARNING: "Status" integer: 1 has a new primary name: "RUNNING", previously "STARTED" which remains an alias [memory/io.Reader]
+`, w.String())
+
+	// the wire profile only reports the type change, as a warning
+	report, err = NewEngine(EngineOptions{Strict: true, Profile: ProfileWire}).
+		Compare(curLock, updLock)
+	assert.Equal(t, ErrWarningsFound, err)
+
+	w.Reset()
+	code, err = HandleReport(report, w, err)
+	assert.Equal(t, ErrWarningsFound, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `WARNING: "Channel" field: "id" has a different type: int64, previously int32 (wire-compatible, but values may be truncated or reinterpreted) [memory/io.Reader]
+`, w.String())
+}
@@ -0,0 +1,178 @@
+package protolock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// ErrDuplicateProtoFile indicates that proto files with the same path are
+// found in more than one tracked proto root, so their Protopaths, which are
+// relative to their roots, are ambiguous.
+var ErrDuplicateProtoFile = errors.New("proto file found in more than one proto root")
+
+// Root is a directory of proto files, like an import path (-I) of protoc. The
+// Protopaths of its files are relative to the root, as are the imports which
+// refer to them.
+type Root struct {
+	Dir string
+	// FS is the file system the files of the root are read from. When nil,
+	// the files are read from Dir on disk.
+	FS fs.FS
+	// IncludeOnly roots are not locked, and their files are only parsed when
+	// imported by locked files, to resolve the types they define.
+	IncludeOnly bool
+}
+
+func (r Root) fsys() fs.FS {
+	if r.FS != nil {
+		return r.FS
+	}
+	return os.DirFS(r.Dir)
+}
+
+// roots returns the proto roots of the Config, in order: the ProtoRoot,
+// followed by the Roots.
+func (cfg *Config) roots() []Root {
+	return append([]Root{{Dir: cfg.ProtoRoot, FS: cfg.ProtoFS}}, cfg.Roots...)
+}
+
+// hasIncludeOnlyRoots reports whether any of the roots are include-only.
+func (cfg *Config) hasIncludeOnlyRoots() bool {
+	for _, root := range cfg.Roots {
+		if root.IncludeOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// displayRoot returns the path of dir relative to the working directory, so
+// that file paths reported by the parser can be found by the caller.
+func displayRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	relpath, err := filepath.Rel(cwd, dir)
+	if err != nil {
+		return ""
+	}
+	return relpath
+}
+
+// BuildIncludes parses the files imported by the definitions of the Protolock
+// which are found in the include-only roots, and the files which they import
+// in turn. Like protoc, each import is looked up in the roots in order, and
+// imports of locked files are not parsed again. Imports which are not found in
+// any include-only root, such as those of well-known types, are skipped. The
+// definitions are used by an Engine to resolve types, see Engine.Includes.
+func BuildIncludes(ctx context.Context, lock Protolock, roots []Root) (*Protolock, error) {
+	seen := make(map[Protopath]bool)
+	var queue []string
+	for _, def := range lock.Definitions {
+		seen[def.Filepath] = true
+	}
+	for _, def := range lock.Definitions {
+		for _, imp := range def.Def.Imports {
+			queue = append(queue, imp.Path)
+		}
+	}
+
+	includes := Protolock{Version: LockVersion}
+	for len(queue) != 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(queue[0])
+		queue = queue[1:]
+
+		protopath := ProtoPath(Protopath(filepath.FromSlash(name)))
+		if seen[protopath] || !fs.ValidPath(name) {
+			continue
+		}
+		seen[protopath] = true
+
+		for _, root := range roots {
+			if !root.IncludeOnly {
+				continue
+			}
+
+			f, err := root.fsys().Open(name)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			entry, err := Parse(filepath.Join(displayRoot(root.Dir), filepath.FromSlash(name)), f)
+			printIfErr(f.Close())
+			if err != nil {
+				return nil, err
+			}
+
+			includes.Definitions = append(includes.Definitions, Definition{
+				Filepath: protopath,
+				Def:      entry,
+			})
+			for _, imp := range entry.Imports {
+				queue = append(queue, imp.Path)
+			}
+			break
+		}
+	}
+
+	return &includes, nil
+}
+
+// buildRoots builds a Protolock of the files in the tracked proto roots of the
+// Config. ErrDuplicateProtoFile is returned if a file is found in more than
+// one root.
+func buildRoots(ctx context.Context, cfg Config) (*Protolock, error) {
+	lock := Protolock{Version: LockVersion}
+	found := make(map[Protopath]string)
+	for _, root := range cfg.roots() {
+		if root.IncludeOnly {
+			continue
+		}
+
+		dir, err := filepath.Abs(root.Dir)
+		if err != nil {
+			return nil, err
+		}
+
+		// the parser reports file paths relative to the working directory
+		built, err := BuildLockContext(ctx, root.fsys(), BuildOptions{
+			Ignore:      cfg.Ignore,
+			DisplayRoot: displayRoot(dir),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, def := range built.Definitions {
+			if other, ok := found[def.Filepath]; ok {
+				return nil, fmt.Errorf(
+					"%w: %s is found in %s and %s",
+					ErrDuplicateProtoFile, OSPath(def.Filepath), other, dir,
+				)
+			}
+			found[def.Filepath] = dir
+		}
+		lock.Definitions = append(lock.Definitions, built.Definitions...)
+	}
+
+	return &lock, nil
+}
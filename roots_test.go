@@ -0,0 +1,143 @@
+package protolock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const moneyProto = `syntax = "proto3";
+package acme.type;
+import "acme/type/currency.proto";
+import "google/protobuf/descriptor.proto";
+message Money { Currency currency = 1; int64 units = 2; }
+`
+
+const currencyProto = `syntax = "proto3";
+package acme.type;
+enum Currency { UNKNOWN = 0; }
+`
+
+const orderProto = `syntax = "proto3";
+package acme.v1;
+import "acme/type/money.proto";
+message Order { acme.type.Money total = 1; }
+`
+
+const requestProto = `syntax = "proto3";
+package acme.svc;
+import "acme/v1/order.proto";
+message Request { acme.v1.Order order = 1; }
+`
+
+func rootsTestConfig(t *testing.T) Config {
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	return Config{
+		ProtoRoot: cwd,
+		ProtoFS: fstest.MapFS{
+			"acme/v1/order.proto": {Data: []byte(orderProto)},
+		},
+		Roots: []Root{
+			{FS: fstest.MapFS{
+				"acme/svc/request.proto": {Data: []byte(requestProto)},
+			}},
+			{IncludeOnly: true, FS: fstest.MapFS{
+				"acme/type/money.proto":    {Data: []byte(moneyProto)},
+				"acme/type/currency.proto": {Data: []byte(currencyProto)},
+				"acme/type/unused.proto":   {Data: []byte(currencyProto)},
+			}},
+		},
+	}
+}
+
+func TestBuildRoots(t *testing.T) {
+	cfg := rootsTestConfig(t)
+
+	lock, err := buildRoots(context.Background(), cfg)
+	require.NoError(t, err)
+
+	var paths []Protopath
+	for _, def := range lock.Definitions {
+		paths = append(paths, def.Filepath)
+	}
+	assert.Equal(t, []Protopath{
+		"acme:/:v1:/:order.proto",
+		"acme:/:svc:/:request.proto",
+	}, paths)
+
+	// paths relative to each root must be unique
+	cfg.Roots[0].FS.(fstest.MapFS)["acme/v1/order.proto"] = &fstest.MapFile{
+		Data: []byte(orderProto),
+	}
+	_, err = buildRoots(context.Background(), cfg)
+	assert.True(t, errors.Is(err, ErrDuplicateProtoFile))
+}
+
+func TestBuildIncludes(t *testing.T) {
+	cfg := rootsTestConfig(t)
+
+	lock, err := buildRoots(context.Background(), cfg)
+	require.NoError(t, err)
+
+	includes, err := BuildIncludes(context.Background(), *lock, cfg.roots())
+	require.NoError(t, err)
+
+	var paths []Protopath
+	for _, def := range includes.Definitions {
+		paths = append(paths, def.Filepath)
+	}
+	assert.Equal(t, []Protopath{
+		"acme:/:type:/:money.proto",
+		"acme:/:type:/:currency.proto",
+	}, paths)
+
+	x := NewIndex(*lock, *includes)
+	assert.Len(t, x.Files(), 2)
+	money, ok := x.Message("acme.type.Money")
+	require.True(t, ok)
+	assert.True(t, money.Included)
+	order, ok := x.Message("acme.v1.Order")
+	require.True(t, ok)
+	assert.False(t, order.Included)
+
+	for scope, name := range map[string]string{
+		"acme.v1.Order":   "acme.type.Money",
+		"acme.v1":         ".acme.type.Money",
+		"acme.type.Money": "Money",
+		"acme.type":       "Money",
+		"acme":            "type.Money",
+	} {
+		resolved, ok := x.ResolveType(scope, name)
+		assert.True(t, ok, name)
+		assert.Equal(t, "acme.type.Money", resolved, name)
+	}
+	resolved, ok := x.ResolveType("acme.type.Money", "Currency")
+	assert.True(t, ok)
+	assert.Equal(t, "acme.type.Currency", resolved)
+	_, ok = x.ResolveType("acme.v1", "Money")
+	assert.False(t, ok)
+	_, ok = x.ResolveType("acme.v1.Order", "int64")
+	assert.False(t, ok)
+
+	// types resolved through includes are not reported as changed
+	updLock := parseTestProto(t, `syntax = "proto3";
+package acme.v1;
+message Order { .acme.type.Money total = 1; }
+`)
+	curLock := parseTestProto(t, orderProto)
+
+	engine := NewEngine(EngineOptions{})
+	report, _ := engine.Compare(curLock, updLock)
+	assert.Equal(t, 1, countRule(report.Warnings, "NoChangingFieldTypes"))
+
+	engine.Includes = *includes
+	report, _ = engine.Compare(curLock, updLock)
+	assert.Equal(t, 0, countRule(report.Warnings, "NoChangingFieldTypes"))
+}
@@ -2,181 +2,257 @@ package protolock
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 )
 
 var (
-	// Rules provides a complete list of all funcs to be run to compare
-	// a set of Protolocks. This list should be updated as new RuleFunc's
-	// are added to this package.
-	Rules = []Rule{
+	// Rules provides a complete list of all funcs to be run by Compare, which
+	// are the built-in rules and any added using RegisterRule.
+	Rules = append([]Rule(nil), builtinRules...)
+
+	// builtinRules provides a complete list of all funcs built in to
+	// protolock. This list should be updated as new RuleFunc's are added to
+	// this package.
+	builtinRules = []Rule{
 		{
-			Name: "NoUsingReservedFields",
-			Func: NoUsingReservedFields,
+			Name:        "NoUsingReservedFields",
+			Description: "Reserved field IDs and names must not be used by fields.",
+			Func:        NoUsingReservedFields,
+			IndexFunc:   noUsingReservedFields,
+			Profiles:    allProfiles,
 		},
 		{
-			Name: "NoRemovingReservedFields",
-			Func: NoRemovingReservedFields,
+			Name:        "NoRemovingReservedFields",
+			Description: "Reserved field IDs and names must not be removed.",
+			Func:        WithIndex(noRemovingReservedFields),
+			IndexFunc:   noRemovingReservedFields,
+			Strict:      true,
+			Profiles:    allProfiles,
 		},
 		{
-			Name: "NoRemovingFieldsWithoutReserve",
-			Func: NoRemovingFieldsWithoutReserve,
+			Name:        "NoRemovingFieldsWithoutReserve",
+			Description: "Removed fields must have their ID and name reserved.",
+			Func:        NoRemovingFieldsWithoutReserve,
+			IndexFunc:   noRemovingFieldsWithoutReserve,
+			Profiles:    allProfiles,
 		},
 		{
-			Name: "NoChangingFieldIDs",
-			Func: NoChangingFieldIDs,
+			Name:        "NoChangingFieldIDs",
+			Description: "Fields must not change their ID.",
+			Func:        NoChangingFieldIDs,
+			IndexFunc:   noChangingFieldIDs,
+			Profiles:    []Profile{ProfileWire},
 		},
 		{
-			Name: "NoChangingFieldTypes",
-			Func: NoChangingFieldTypes,
+			Name:        "NoChangingFieldTypes",
+			Description: "Fields must not change their type.",
+			Func:        NoChangingFieldTypes,
+			IndexFunc:   checkFieldTypes,
+			Profiles:    allProfiles,
+			engineFunc:  fieldTypesRule,
 		},
 		{
-			Name: "NoChangingFieldNames",
-			Func: NoChangingFieldNames,
+			Name:        "NoChangingFieldNames",
+			Description: "Fields must not change their name.",
+			Func:        WithIndex(noChangingFieldNames),
+			IndexFunc:   noChangingFieldNames,
+			Strict:      true,
+			Profiles:    []Profile{ProfileJSON, ProfileSource},
 		},
 		{
-			Name: "NoRemovingRPCs",
-			Func: NoRemovingRPCs,
+			Name:        "NoRemovingRPCs",
+			Description: "RPCs must not be removed from services.",
+			Func:        WithIndex(noRemovingRPCs),
+			IndexFunc:   noRemovingRPCs,
+			Strict:      true,
+			Profiles:    allProfiles,
 		},
 		{
-			Name: "NoChangingRPCSignature",
-			Func: NoChangingRPCSignature,
+			Name:        "NoChangingRPCSignature",
+			Description: "RPCs must not change their request, response or streaming.",
+			Func:        NoChangingRPCSignature,
+			IndexFunc:   noChangingRPCSignature,
+			Profiles:    allProfiles,
 		},
 		{
-			Name: "NoMovingExistingFieldsIntoOrOutOfOneof",
-			Func: NoMovingExistingFieldsIntoOrOutOfOneof,
+			Name:        "NoMovingExistingFieldsIntoOrOutOfOneof",
+			Description: "Existing fields must not move into or out of a oneof.",
+			Func:        NoMovingExistingFieldsIntoOrOutOfOneof,
+			IndexFunc:   noMovingExistingFieldsIntoOrOutOfOneof,
+			Profiles:    allProfiles,
+		},
+		{
+			Name:        "NoChangingSensitiveOptions",
+			Description: "Sensitive options must not be changed or removed.",
+			Func:        NoChangingSensitiveOptions,
+			IndexFunc:   checkSensitiveOptions,
+			Profiles:    allProfiles,
+			engineFunc:  sensitiveOptionsRule,
+		},
+		{
+			Name:        "NoRemovingEnumAllowAlias",
+			Description: "Enums must not remove the allow_alias option.",
+			Func:        NoRemovingEnumAllowAlias,
+			IndexFunc:   noRemovingEnumAllowAlias,
+			Profiles:    []Profile{ProfileJSON, ProfileSource},
+		},
+		{
+			Name:        "NoChangingEnumAliases",
+			Description: "Enum aliases must not be changed.",
+			Func:        NoChangingEnumAliases,
+			IndexFunc:   noChangingEnumAliases,
+			// changing the primary name of an aliased value only changes the
+			// name used when encoding to JSON, and is often deliberate, so
+			// the rule is only run in strict mode
+			Strict:   true,
+			Profiles: []Profile{ProfileJSON, ProfileSource},
+		},
+		{
+			Name:        "NoChangingEnumZeroValue",
+			Description: "Proto3 enums must not remove their zero value, or start with a non-zero value.",
+			Func:        NoChangingEnumZeroValue,
+			IndexFunc:   noChangingEnumZeroValue,
+			Profiles:    allProfiles,
+		},
+		{
+			Name:        "NoRenamingEnumZeroValue",
+			Description: "Enums must not rename their zero value.",
+			Func:        NoRenamingEnumZeroValue,
+			IndexFunc:   noRenamingEnumZeroValue,
+			Profiles:    []Profile{ProfileJSON, ProfileSource},
 		},
 	}
 
-	strict = true
-	debug  = false
+	// DefaultSensitiveOptions lists the options which affect the wire format,
+	// JSON mapping or generated code of a definition, and are therefore
+	// checked by NoChangingSensitiveOptions unless overridden.
+	DefaultSensitiveOptions = []string{
+		// file options
+		"go_package",
+		"java_package",
+		"java_outer_classname",
+		"java_multiple_files",
+		"csharp_namespace",
+		"objc_class_prefix",
+		"php_namespace",
+		"php_class_prefix",
+		"php_metadata_namespace",
+		"ruby_package",
+		"swift_prefix",
+		"optimize_for",
+		// message options
+		"message_set_wire_format",
+		"map_entry",
+		// field options
+		"json_name",
+		"packed",
+		"ctype",
+		"jstype",
+		// options of any definition, including enums, enum values and RPCs
+		"deprecated",
+		"idempotency_level",
+	}
+
+	// sensitiveOptionProfiles lists the profiles protected by checking each
+	// of the DefaultSensitiveOptions. Other options protect all profiles.
+	sensitiveOptionProfiles = map[string][]Profile{
+		"go_package":              {ProfileSource},
+		"java_package":            {ProfileSource},
+		"java_outer_classname":    {ProfileSource},
+		"java_multiple_files":     {ProfileSource},
+		"csharp_namespace":        {ProfileSource},
+		"objc_class_prefix":       {ProfileSource},
+		"php_namespace":           {ProfileSource},
+		"php_class_prefix":        {ProfileSource},
+		"php_metadata_namespace":  {ProfileSource},
+		"ruby_package":            {ProfileSource},
+		"swift_prefix":            {ProfileSource},
+		"optimize_for":            {ProfileSource},
+		"message_set_wire_format": {ProfileWire},
+		"map_entry":               allProfiles,
+		"json_name":               {ProfileJSON},
+		"packed":                  {ProfileWire},
+		"ctype":                   {ProfileSource},
+		"jstype":                  {ProfileSource},
+		"deprecated":              {ProfileSource},
+		"idempotency_level":       {ProfileWire, ProfileSource},
+	}
 )
 
 const nestedPrefix = "."
 
-// SetStrict enables the user to toggle strict mode on and off.
+// SetStrict enables the user to toggle strict mode of the default Engine on
+// and off.
 func SetStrict(mode bool) {
-	strict = mode
+	std.Strict = mode
 }
 
-// SetDebug enables the user to toggle debug mode on and off.
+// SetDebug enables the user to toggle debug mode of the default Engine on and
+// off. Debug output is passed to the Logger, see SetLogger.
 func SetDebug(status bool) {
-	debug = status
+	std.Debug = nil
+	if status {
+		std.Debug = logWriter{}
+	}
+}
+
+// SetSensitiveOptions replaces the list of option names checked by the
+// NoChangingSensitiveOptions rule of the default Engine. An empty list restores
+// the defaults.
+func SetSensitiveOptions(names []string) {
+	std.SetSensitiveOptions(names)
+}
+
+// trimNames returns a copy of names with surrounding whitespace removed, or
+// nil if there are none.
+func trimNames(names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+
+	trimmed := make([]string, 0, len(names))
+	for _, name := range names {
+		trimmed = append(trimmed, strings.TrimSpace(name))
+	}
+	return trimmed
 }
 
+// Rule is a named RuleFunc run by Compare.
 type Rule struct {
 	Name string
-	Func RuleFunc
+	// Description is a short, human-readable summary of what the rule
+	// enforces.
+	Description string
+	Func        RuleFunc
+	// IndexFunc, when set, is used in place of Func by an Engine, which
+	// passes it the Indexes of the Protolocks it compares, shared by all
+	// rules. Rules registered with only an IndexFunc have their Func set to
+	// WithIndex(IndexFunc).
+	IndexFunc IndexRuleFunc
+	// Strict rules are only run when strict mode is enabled.
+	Strict bool
+	// Profiles lists the compatibility guarantees which the rule protects.
+	// When a profile is selected, rules which do not protect it are skipped.
+	Profiles []Profile
+
+	// engineFunc, when set, returns the IndexFunc used by an Engine, for
+	// built-in rules which depend on its settings.
+	engineFunc func(e *Engine) IndexRuleFunc
 }
 
 // RuleFunc defines the common signature for a function which can compare
 // Protolock states and determine if issues exist.
 type RuleFunc func(current, updated Protolock) ([]Warning, bool)
 
-// lockIDsMap:
-// table of filepath -> message name -> reserved field ID -> times ID encountered
-// i.e.
-/*
-	["test.proto"] 	-> ["Test"] -> [1] -> 1
-
-			-> ["User"] -> [1] -> 1
-				       [2] -> 1
-				       [3] -> 1
-
-			-> ["Plan"] -> [1] -> 1
-				       [2] -> 1
-				       [3] -> 1
-*/
-type lockIDsMap map[Protopath]map[string]map[int]int
-
-// lockNamesMap:
-// table of filepath -> message name -> field name -> times name encountered (or the field ID)
-// i.e.
-/*
-	["test.proto"]	->	["Test"]	->	["field_one"]	->	1
-			-> 	["User"] 	-> 	["field_one"] 	-> 	1
-							["field_two"] 	-> 	1
-							["field_three"] -> 	1
-
-			-> 	["Plan"] 	-> 	["field_one"] 	-> 	1
-				       			["field_two"] 	-> 	1
-				       			["field_three"] -> 	1
-			# if mapping field name -> id,
-			-> 	["Account"] 	-> 	["field_one"] 	-> 	1
-						-> 	["field_two"] 	-> 	2
-						-> 	["field_three"] -> 	3
-*/
-type lockNamesMap map[Protopath]map[string]map[string]int
-
-// lockFieldMap:
-// table of filepath -> message name -> field name -> field type
-type lockFieldMap map[Protopath]map[string]map[string]Field
-
-// lockEnumFieldMap:
-// table of filepath -> message name -> field name -> enum field type
-type lockEnumFieldMap map[Protopath]map[string]map[string]EnumField
-
-// lockMapMap:
-// table of filepath -> message name -> Map name -> Map type
-type lockMapMap map[Protopath]map[string]map[string]Map
-
-// lockRPCMap:
-// table of filepath -> service name -> rpc name -> rpc type
-type lockRPCMap map[Protopath]map[string]map[string]RPC
-
-// lockFieldIDNameMap:
-// table of filepath -> message name -> field ID -> field name
-type lockFieldIDNameMap map[Protopath]map[string]map[int]string
-
-func incMessageFields(reservedIDMap lockIDsMap, reservedNameMap lockNamesMap, filepath Protopath, prefix string, msg Message) {
-	name := prefix + msg.Name
-	for _, field := range msg.Fields {
-		if reservedIDMap[filepath][name] == nil {
-			reservedIDMap[filepath][name] = make(map[int]int)
-		}
-		if reservedNameMap[filepath][name] == nil {
-			reservedNameMap[filepath][name] = make(map[string]int)
-		}
-		reservedIDMap[filepath][name][field.ID]++
-		reservedNameMap[filepath][name][field.Name]++
-	}
-	for _, mp := range msg.Maps {
-		if reservedIDMap[filepath][name] == nil {
-			reservedIDMap[filepath][name] = make(map[int]int)
-		}
-		if reservedNameMap[filepath][name] == nil {
-			reservedNameMap[filepath][name] = make(map[string]int)
-		}
-		reservedIDMap[filepath][name][mp.Field.ID]++
-		reservedNameMap[filepath][name][mp.Field.Name]++
-	}
+// IndexRuleFunc is a RuleFunc which compares Protolocks using their Indexes.
+type IndexRuleFunc func(current, updated *Index) ([]Warning, bool)
 
-	for _, m := range msg.Messages {
-		incMessageFields(
-			reservedIDMap, reservedNameMap,
-			filepath, name+nestedPrefix, m,
-		)
-	}
-}
-
-func incEnumFields(reservedIDMap lockIDsMap, reservedNameMap lockNamesMap, filepath Protopath, enum Enum) {
-	for _, field := range enum.EnumFields {
-		if reservedIDMap[filepath][enum.Name] == nil {
-			reservedIDMap[filepath][enum.Name] = make(map[int]int)
-		}
-		if reservedNameMap[filepath][enum.Name] == nil {
-			reservedNameMap[filepath][enum.Name] = make(map[string]int)
-		}
-
-		for id := range reservedIDMap[filepath][enum.Name] {
-			if field.Integer == id {
-				reservedIDMap[filepath][enum.Name][field.Integer]++
-			}
-		}
-		for name := range reservedNameMap[filepath][enum.Name] {
-			if field.Name == name {
-				reservedNameMap[filepath][enum.Name][field.Name]++
-			}
-		}
+// WithIndex returns a RuleFunc which indexes the Protolocks it compares, and
+// runs fn.
+func WithIndex(fn IndexRuleFunc) RuleFunc {
+	return func(cur, upd Protolock) ([]Warning, bool) {
+		return fn(NewIndex(cur), NewIndex(upd))
 	}
 }
 
@@ -184,119 +260,81 @@ func incEnumFields(reservedIDMap lockIDsMap, reservedNameMap lockNamesMap, filep
 // and will return a list of warnings if any message's previously reserved fields
 // or IDs are now being used as part of the same message.
 func NoUsingReservedFields(cur, upd Protolock) ([]Warning, bool) {
-	reservedIDMap, reservedNameMap := getReservedFields(cur)
-	reservedEnumIDMap, reservedEnumNameMap := getReservedEnumFields(cur)
-
-	// add each messages field name/number to the existing list identified as
-	// reserved to analyze
-	for _, def := range upd.Definitions {
-		if reservedIDMap[def.Filepath] == nil {
-			reservedIDMap[def.Filepath] = make(map[string]map[int]int)
-		}
-		if reservedNameMap[def.Filepath] == nil {
-			reservedNameMap[def.Filepath] = make(map[string]map[string]int)
-		}
-		for _, msg := range def.Def.Messages {
-			incMessageFields(
-				reservedIDMap, reservedNameMap,
-				def.Filepath, "", msg,
-			)
-		}
-
-		if reservedEnumIDMap[def.Filepath] == nil {
-			reservedEnumIDMap[def.Filepath] = make(map[string]map[int]int)
-		}
-		if reservedEnumNameMap[def.Filepath] == nil {
-			reservedEnumNameMap[def.Filepath] = make(map[string]map[string]int)
-		}
-		for _, enum := range def.Def.Enums {
-			incEnumFields(
-				reservedEnumIDMap, reservedEnumNameMap,
-				def.Filepath, enum,
-			)
-		}
-	}
+	return noUsingReservedFields(NewIndex(cur), NewIndex(upd))
+}
 
+func noUsingReservedFields(cur, upd *Index) ([]Warning, bool) {
 	var warnings []Warning
 
 	// Find message conflicts (using reserved names or IDs)
 
-	// if the field ID was encountered more than once per message, then it
-	// is known to be a re-use of a reserved field and a warning should be
-	// returned for each occurrance
-	for path, m := range reservedIDMap {
-		for msgName, mm := range m {
-			for id, count := range mm {
-				if count > 1 {
-					msg := fmt.Sprintf(
-						`"%s" is re-using ID: %d, a reserved field number`,
-						msgName, id,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+	// a warning is returned once for each reserved field ID or name of the
+	// current message which is used by a field of the updated message
+	for _, updMsg := range upd.definedMessages {
+		curMsg, ok := cur.matchMessage(updMsg)
+		if !ok {
+			continue
+		}
+
+		reservedIDs := set(curMsg.Message.ReservedIDs)
+		reservedNames := set(curMsg.Message.ReservedNames)
+		for _, field := range updMsg.fields() {
+			if reservedIDs[field.ID] {
+				delete(reservedIDs, field.ID)
+				msg := fmt.Sprintf(
+					`"%s" is re-using ID: %d, a reserved field number`,
+					updMsg.local, field.ID,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updMsg.Filepath),
+					Message:  msg,
+				})
 			}
-		}
-	}
-	// if the field name was encountered more than once per message, then it
-	// is known to be a re-use of a reserved field and a warning should be
-	// returned for each occurrance
-	for path, m := range reservedNameMap {
-		for msgName, mm := range m {
-			for name, count := range mm {
-				if count > 1 {
-					msg := fmt.Sprintf(
-						`"%s" is re-using name: "%s", a reserved field name`,
-						msgName, name,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+			if reservedNames[field.Name] {
+				delete(reservedNames, field.Name)
+				msg := fmt.Sprintf(
+					`"%s" is re-using name: "%s", a reserved field name`,
+					updMsg.local, field.Name,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updMsg.Filepath),
+					Message:  msg,
+				})
 			}
 		}
 	}
 
 	// Find enum conflicts (using reserved names or integers)
-
-	// if the enum value was encountered more than once per message, then it
-	// is known to be a re-use of a reserved field and a warning should be
-	// returned for each occurrance
-	for path, m := range reservedEnumIDMap {
-		for enumName, mm := range m {
-			for id, count := range mm {
-				if count > 1 {
-					msg := fmt.Sprintf(
-						`"%s" is re-using integer: %d, a reserved value`,
-						enumName, id,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+	for _, updEnum := range upd.definedEnums {
+		curEnum, ok := cur.matchEnum(updEnum)
+		if !ok {
+			continue
+		}
+
+		reservedIDs := set(curEnum.Enum.ReservedIDs)
+		reservedNames := set(curEnum.Enum.ReservedNames)
+		for _, field := range updEnum.Enum.EnumFields {
+			if reservedIDs[field.Integer] {
+				delete(reservedIDs, field.Integer)
+				msg := fmt.Sprintf(
+					`"%s" is re-using integer: %d, a reserved value`,
+					updEnum.Enum.Name, field.Integer,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updEnum.Filepath),
+					Message:  msg,
+				})
 			}
-		}
-	}
-	// if the enum name was encountered more than once per message, then it
-	// is known to be a re-use of a reserved field and a warning should be
-	// returned for each occurrance
-	for path, m := range reservedEnumNameMap {
-		for enumName, mm := range m {
-			for name, count := range mm {
-				if count > 1 {
-					msg := fmt.Sprintf(
-						`"%s" is re-using name: "%s", a reserved name`,
-						enumName, name,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+			if reservedNames[field.Name] {
+				delete(reservedNames, field.Name)
+				msg := fmt.Sprintf(
+					`"%s" is re-using name: "%s", a reserved name`,
+					updEnum.Enum.Name, field.Name,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updEnum.Filepath),
+					Message:  msg,
+				})
 			}
 		}
 	}
@@ -312,82 +350,84 @@ func NoUsingReservedFields(cur, upd Protolock) ([]Warning, bool) {
 // and will return a list of warnings if any reserved field has been removed. This
 // rule is only enforced when strict mode is enabled.
 func NoRemovingReservedFields(cur, upd Protolock) ([]Warning, bool) {
-	if !strict {
+	if !std.Strict {
 		return nil, true
 	}
 
+	return noRemovingReservedFields(NewIndex(cur), NewIndex(upd))
+}
+
+func noRemovingReservedFields(cur, upd *Index) ([]Warning, bool) {
 	var warnings []Warning
 	// check that all reserved fields on current Protolock remain in the
-	// updated Protolock
+	// updated Protolock, which includes those of removed messages and enums
 
 	// check all reserved fields on messages
-	curReservedIDMap, curReservedNameMap := getReservedFields(cur)
-	updReservedIDMap, updReservedNameMap := getReservedFields(upd)
-	for path, msgMap := range curReservedIDMap {
-		for msgName, idMap := range msgMap {
-			for id := range idMap {
-				if _, ok := updReservedIDMap[path][msgName][id]; !ok {
-					msg := fmt.Sprintf(
-						`"%s" is missing ID: %d, which had been reserved`,
-						msgName, id,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+	for _, curMsg := range cur.definedMessages {
+		path := curMsg.Filepath
+		var updReserved Message
+		if updMsg, ok := upd.matchMessage(curMsg); ok {
+			path, updReserved = updMsg.Filepath, updMsg.Message
+		}
+
+		updIDs, updNames := set(updReserved.ReservedIDs), set(updReserved.ReservedNames)
+		for _, id := range curMsg.Message.ReservedIDs {
+			if !updIDs[id] {
+				msg := fmt.Sprintf(
+					`"%s" is missing ID: %d, which had been reserved`,
+					curMsg.local, id,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
 			}
 		}
-	}
-	for path, msgMap := range curReservedNameMap {
-		for msgName, nameMap := range msgMap {
-			for name := range nameMap {
-				if _, ok := updReservedNameMap[path][msgName][name]; !ok {
-					msg := fmt.Sprintf(
-						`"%s" is missing name: "%s", which had been reserved`,
-						msgName, name,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+		for _, name := range curMsg.Message.ReservedNames {
+			if !updNames[name] {
+				msg := fmt.Sprintf(
+					`"%s" is missing name: "%s", which had been reserved`,
+					curMsg.local, name,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
 			}
 		}
 	}
 
 	// check all reserved fields on enums
-	curReservedEnumIDMap, curReservedEnumNameMap := getReservedEnumFields(cur)
-	updReservedEnumIDMap, updReservedEnumNameMap := getReservedEnumFields(upd)
-	for path, enumMap := range curReservedEnumIDMap {
-		for enumName, idMap := range enumMap {
-			for id := range idMap {
-				if _, ok := updReservedEnumIDMap[path][enumName][id]; !ok {
-					msg := fmt.Sprintf(
-						`"%s" is missing integer: %d, which had been reserved`,
-						enumName, id,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+	for _, curEnum := range cur.definedEnums {
+		path := curEnum.Filepath
+		var updReserved Enum
+		if updEnum, ok := upd.matchEnum(curEnum); ok {
+			path, updReserved = updEnum.Filepath, updEnum.Enum
+		}
+
+		updIDs, updNames := set(updReserved.ReservedIDs), set(updReserved.ReservedNames)
+		for _, id := range curEnum.Enum.ReservedIDs {
+			if !updIDs[id] {
+				msg := fmt.Sprintf(
+					`"%s" is missing integer: %d, which had been reserved`,
+					curEnum.Enum.Name, id,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
 			}
 		}
-	}
-	for path, enumMap := range curReservedEnumNameMap {
-		for enumName, nameMap := range enumMap {
-			for name := range nameMap {
-				if _, ok := updReservedEnumNameMap[path][enumName][name]; !ok {
-					msg := fmt.Sprintf(
-						`"%s" is missing name: "%s", which had been reserved`,
-						enumName, name,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+		for _, name := range curEnum.Enum.ReservedNames {
+			if !updNames[name] {
+				msg := fmt.Sprintf(
+					`"%s" is missing name: "%s", which had been reserved`,
+					curEnum.Enum.Name, name,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
 			}
 		}
 	}
@@ -402,56 +442,54 @@ func NoRemovingReservedFields(cur, upd Protolock) ([]Warning, bool) {
 // NoChangingFieldIDs compares the current vs. updated Protolock definitions and
 // will return a list of warnings if any field ID number has been changed.
 func NoChangingFieldIDs(cur, upd Protolock) ([]Warning, bool) {
+	return noChangingFieldIDs(NewIndex(cur), NewIndex(upd))
+}
+
+func noChangingFieldIDs(cur, upd *Index) ([]Warning, bool) {
 	var warnings []Warning
 
-	// check all non-reserved message fields
-	curNameIDMap := getNonReservedFields(cur)
-	updNameIDMap := getNonReservedFields(upd)
-
-	// check that all current Protolock names map to the same IDs as the
-	// updated Protolock
-	for path, msgMap := range curNameIDMap {
-		for msgName, fieldMap := range msgMap {
-			for fieldName, fieldID := range fieldMap {
-				updFieldID, ok := updNameIDMap[path][msgName][fieldName]
-				if ok {
-					if updFieldID != fieldID {
-						msg := fmt.Sprintf(
-							`"%s" field: "%s" has a different ID: %d, previously %d`,
-							msgName, fieldName, updFieldID, fieldID,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-				}
+	// check that all current Protolock message fields have the same IDs as
+	// the fields with the same names in the updated Protolock
+	for _, curMsg := range cur.definedMessages {
+		updMsg, ok := upd.matchMessage(curMsg)
+		if !ok {
+			continue
+		}
+
+		for _, field := range curMsg.fields() {
+			updField, ok := updMsg.FieldByName(field.Name)
+			if ok && updField.ID != field.ID {
+				msg := fmt.Sprintf(
+					`"%s" field: "%s" has a different ID: %d, previously %d`,
+					curMsg.local, field.Name, updField.ID, field.ID,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updMsg.Filepath),
+					Message:  msg,
+				})
 			}
 		}
 	}
 
-	// check all non-reserved enum fields
-	curEnumNameIDMap := getNonReservedEnumFields(cur)
-	updEnumNameIDMap := getNonReservedEnumFields(upd)
-
-	// check that all current Protolock names map to the same IDs as the
-	// updated Protolock
-	for path, enumMap := range curEnumNameIDMap {
-		for enumName, fieldMap := range enumMap {
-			for fieldName, fieldInteger := range fieldMap {
-				updFieldInteger, ok := updEnumNameIDMap[path][enumName][fieldName]
-				if ok {
-					if updFieldInteger != fieldInteger {
-						msg := fmt.Sprintf(
-							`"%s" field: "%s" has a different integer: %d, previously %d`,
-							enumName, fieldName, updFieldInteger, fieldInteger,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-				}
+	// check that all current Protolock enum fields have the same integers as
+	// the fields with the same names in the updated Protolock
+	for _, curEnum := range cur.definedEnums {
+		updEnum, ok := upd.matchEnum(curEnum)
+		if !ok {
+			continue
+		}
+
+		for _, field := range curEnum.Enum.EnumFields {
+			updField, ok := updEnum.ValueByName(field.Name)
+			if ok && updField.Integer != field.Integer {
+				msg := fmt.Sprintf(
+					`"%s" field: "%s" has a different integer: %d, previously %d`,
+					curEnum.Enum.Name, field.Name, updField.Integer, field.Integer,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updEnum.Filepath),
+					Message:  msg,
+				})
 			}
 		}
 	}
@@ -464,64 +502,92 @@ func NoChangingFieldIDs(cur, upd Protolock) ([]Warning, bool) {
 }
 
 // NoChangingFieldTypes compares the current vs. updated Protolock definitions and
-// will return a list of warnings if any field type has been changed.
+// will return a list of warnings if any field type has been changed. Each type
+// change is classified by its wire compatibility (see classifyTypeChange), and
+// the warning message states which kind of change was made. Changes which are
+// wire-compatible have SeverityWarning when the wire profile is selected, and
+// are otherwise errors, as they still change the JSON mapping and generated
+// code.
 func NoChangingFieldTypes(cur, upd Protolock) ([]Warning, bool) {
-	curFieldMap := getFieldMap(cur)
-	updFieldMap := getFieldMap(upd)
-	curMapMap := getMapMap(cur)
-	updMapMap := getMapMap(upd)
+	return checkFieldTypes(NewIndex(cur), NewIndex(upd))
+}
+
+// checkFieldTypes checks the field types using the profile of the default
+// Engine.
+func checkFieldTypes(cur, upd *Index) ([]Warning, bool) {
+	return noChangingFieldTypes(std, cur, upd)
+}
+
+// fieldTypesRule returns a NoChangingFieldTypes rule check which uses the
+// profile of the Engine.
+func fieldTypesRule(e *Engine) IndexRuleFunc {
+	return func(cur, upd *Index) ([]Warning, bool) {
+		return noChangingFieldTypes(e, cur, upd)
+	}
+}
+
+func noChangingFieldTypes(e *Engine, cur, upd *Index) ([]Warning, bool) {
 	var warnings []Warning
 	// check that the current Protolock message's field types are the same
 	// for each of the same message's fields in the updated Protolock
-	for path, msgMap := range curFieldMap {
-		for msgName, fieldMap := range msgMap {
-			for fieldName, field := range fieldMap {
-				updField, ok := updFieldMap[path][msgName][fieldName]
-				if ok {
-					if updField.Type != field.Type {
-						msg := fmt.Sprintf(
-							`"%s" field: "%s" has a different type: %s, previously %s`,
-							msgName, fieldName, updField.Type, field.Type,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-
-					if updField.IsRepeated != field.IsRepeated {
-						msg := fmt.Sprintf(
-							`"%s" field: "%s" has a different "repeated" status: %t, previously %t`,
-							msgName, fieldName, updField.IsRepeated, field.IsRepeated,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-				}
+	for _, curMsg := range cur.definedMessages {
+		updMsg, ok := upd.matchMessage(curMsg)
+		if !ok {
+			continue
+		}
+
+		for _, field := range curMsg.fields() {
+			updField, ok := updMsg.FieldByName(field.Name)
+			if !ok {
+				continue
+			}
+
+			if updField.Type != field.Type &&
+				!sameType(cur, upd, curMsg, updMsg, field.Type, updField.Type) {
+				change := classifyTypeChange(
+					cur.wireType(curMsg.Name, field.Type),
+					upd.wireType(updMsg.Name, updField.Type),
+				)
+				msg := fmt.Sprintf(
+					`"%s" field: "%s" has a different type: %s, previously %s%s`,
+					curMsg.local, field.Name, updField.Type, field.Type,
+					change.suffix(),
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updMsg.Filepath),
+					Message:  msg,
+					Severity: change.severity(e.Profile),
+				})
+			}
+
+			if updField.IsRepeated != field.IsRepeated {
+				msg := fmt.Sprintf(
+					`"%s" field: "%s" has a different "repeated" status: %t, previously %t`,
+					curMsg.local, field.Name, updField.IsRepeated, field.IsRepeated,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updMsg.Filepath),
+					Message:  msg,
+				})
 			}
 		}
-	}
 
-	// check that the current Protolock message's map types are the same
-	// for each of the same message's maps in the updated Protolock
-	for path, msgMap := range curMapMap {
-		for msgName, mapMap := range msgMap {
-			for fieldName, mp := range mapMap {
-				updMap, ok := updMapMap[path][msgName][fieldName]
-				if ok {
-					if updMap.KeyType != mp.KeyType {
-						msg := fmt.Sprintf(
-							`"%s" field: "%s" has a different type: %s, previously %s`,
-							msgName, fieldName, updMap.KeyType, mp.KeyType,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-				}
+		// check that the current Protolock message's map key types are the
+		// same for each of the same message's maps in the updated Protolock
+		for _, mp := range curMsg.Message.Maps {
+			updMap, ok := findMap(updMsg.Message, mp.Field.Name)
+			if ok && updMap.KeyType != mp.KeyType {
+				change := classifyTypeChange(mp.KeyType, updMap.KeyType)
+				msg := fmt.Sprintf(
+					`"%s" field: "%s" has a different type: %s, previously %s%s`,
+					curMsg.local, mp.Field.Name, updMap.KeyType, mp.KeyType,
+					change.suffix(),
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updMsg.Filepath),
+					Message:  msg,
+					Severity: change.severity(e.Profile),
+				})
 			}
 		}
 	}
@@ -533,64 +599,171 @@ func NoChangingFieldTypes(cur, upd Protolock) ([]Warning, bool) {
 	return nil, true
 }
 
+// findMap returns the map of the message with the name.
+func findMap(msg Message, name string) (Map, bool) {
+	for _, mp := range msg.Maps {
+		if mp.Field.Name == name {
+			return mp, true
+		}
+	}
+	return Map{}, false
+}
+
+// sameType reports whether the differently written types of a field resolve to
+// the same message or enum, e.g. "Channel" and ".test.Channel".
+func sameType(cur, upd *Index, curMsg, updMsg *IndexedMessage, curType, updType string) bool {
+	curName, ok := cur.ResolveType(curMsg.Name, curType)
+	if !ok {
+		return false
+	}
+
+	updName, ok := upd.ResolveType(updMsg.Name, updType)
+	return ok && curName == updName
+}
+
+// typeChange classifies a change of field type by its effect on the wire.
+type typeChange int
+
+const (
+	// typeChangeBreaking indicates the old and new types are encoded
+	// differently, and existing data cannot be read using the new type.
+	typeChangeBreaking typeChange = iota
+
+	// typeChangeWireCompatible indicates the old and new types share an
+	// encoding, but values may be truncated or reinterpreted when read.
+	typeChangeWireCompatible
+
+	// typeChangeConditional indicates the old and new types share an
+	// encoding, and are only compatible if all values are valid UTF-8.
+	typeChangeConditional
+)
+
+// suffix returns the text appended to a type change warning message.
+func (c typeChange) suffix() string {
+	switch c {
+	case typeChangeWireCompatible:
+		return " (wire-compatible, but values may be truncated or reinterpreted)"
+	case typeChangeConditional:
+		return " (wire-compatible only if all values are valid UTF-8)"
+	default:
+		return " (breaking, existing values cannot be read)"
+	}
+}
+
+// severity returns the Severity of a type change warning when the profile is
+// enforced. Changes which are wire-compatible still change the JSON mapping
+// and generated code, so they are only reported as warnings when the wire
+// profile is selected.
+func (c typeChange) severity(p Profile) Severity {
+	if c != typeChangeBreaking && p == ProfileWire {
+		return SeverityWarning
+	}
+	return SeverityError
+}
+
+const enumWireType = "enum"
+
+// wireTypeGroups lists the sets of scalar types which are interchangeable on
+// the wire, per https://protobuf.dev/programming-guides/proto3/#updating
+var wireTypeGroups = [][]string{
+	{"int32", "uint32", "int64", "uint64", "bool", enumWireType},
+	{"sint32", "sint64"},
+	{"fixed32", "sfixed32"},
+	{"fixed64", "sfixed64"},
+}
+
+// classifyTypeChange determines the kind of change made when a field's type
+// changes from one type to another. Enum types are expected to have been
+// normalized to "enum" by wireType.
+func classifyTypeChange(from, to string) typeChange {
+	if (from == "string" && to == "bytes") || (from == "bytes" && to == "string") {
+		return typeChangeConditional
+	}
+
+	for _, group := range wireTypeGroups {
+		if containsString(group, from) && containsString(group, to) {
+			return typeChangeWireCompatible
+		}
+	}
+
+	return typeChangeBreaking
+}
+
+// wireType returns "enum" if the type name, looked up from within scope (see
+// ResolveType), refers to an enum, otherwise the type name is returned as-is.
+func (x *Index) wireType(scope, typeName string) string {
+	if name, ok := x.ResolveType(scope, typeName); ok {
+		if _, isEnum := x.enums[name]; isEnum {
+			return enumWireType
+		}
+	}
+	return typeName
+}
+
 // NoChangingFieldNames compares the current vs. updated Protolock definitions and
 // will return a list of warnings if any message's previous fields have been
 // renamed. This rule is only enforced when strict mode is enabled.
 func NoChangingFieldNames(cur, upd Protolock) ([]Warning, bool) {
-	if !strict {
+	if !std.Strict {
 		return nil, true
 	}
 
-	var warnings []Warning
+	return noChangingFieldNames(NewIndex(cur), NewIndex(upd))
+}
 
-	// check all field names of messages
-	curFieldMap := getFieldsIDName(cur)
-	updFieldMap := getFieldsIDName(upd)
+func noChangingFieldNames(cur, upd *Index) ([]Warning, bool) {
+	var warnings []Warning
 
 	// check that the current Protolock messages' field names are equal to
 	// their relative messages' field names in the updated Protolock
-	for path, msgMap := range curFieldMap {
-		for msgName, fieldMap := range msgMap {
-			for fieldID, fieldName := range fieldMap {
-				updFieldName, ok := updFieldMap[path][msgName][fieldID]
-				if ok {
-					if updFieldName != fieldName {
-						msg := fmt.Sprintf(
-							`"%s" field: "%s" ID: %d has an updated name, previously "%s"`,
-							msgName, updFieldName, fieldID, fieldName,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-				}
+	for _, curMsg := range cur.definedMessages {
+		updMsg, ok := upd.matchMessage(curMsg)
+		if !ok {
+			continue
+		}
+
+		for _, field := range curMsg.fields() {
+			updField, ok := updMsg.FieldByID(field.ID)
+			if ok && updField.Name != field.Name {
+				msg := fmt.Sprintf(
+					`"%s" field: "%s" ID: %d has an updated name, previously "%s"`,
+					curMsg.local, updField.Name, field.ID, field.Name,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updMsg.Filepath),
+					Message:  msg,
+				})
 			}
 		}
 	}
 
-	// check all field names of enums
-	curEnumFieldMap := getEnumFieldsIDName(cur)
-	updEnumFieldMap := getEnumFieldsIDName(upd)
-
 	// check that the current Protolock enums' field names are equal to
-	// their relative enums' field names in the updated Protolock
-	for path, enumMap := range curEnumFieldMap {
-		for enumName, fieldMap := range enumMap {
-			for fieldInteger, fieldName := range fieldMap {
-				updFieldName, ok := updEnumFieldMap[path][enumName][fieldInteger]
-				if ok {
-					if updFieldName != fieldName {
-						msg := fmt.Sprintf(
-							`"%s" field: "%s" integer: %d has an updated name, previously "%s"`,
-							enumName, updFieldName, fieldInteger, fieldName,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-				}
+	// their relative enums' field names in the updated Protolock. Integers
+	// with aliases in either Protolock are checked by NoChangingEnumAliases,
+	// and the zero value by NoRenamingEnumZeroValue.
+	for _, curEnum := range cur.definedEnums {
+		updEnum, ok := upd.matchEnum(curEnum)
+		if !ok {
+			continue
+		}
+
+		for _, integer := range enumIntegers(curEnum.Enum) {
+			names := curEnum.ValuesByNumber(integer)
+			updNames := updEnum.ValuesByNumber(integer)
+			if integer == 0 || len(names) != 1 || len(updNames) != 1 {
+				continue
+			}
+
+			name, updName := names[0].Name, updNames[0].Name
+			if updName != name {
+				msg := fmt.Sprintf(
+					`"%s" field: "%s" integer: %d has an updated name, previously "%s"`,
+					curEnum.Enum.Name, updName, integer, name,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updEnum.Filepath),
+					Message:  msg,
+				})
 			}
 		}
 	}
@@ -602,35 +775,57 @@ func NoChangingFieldNames(cur, upd Protolock) ([]Warning, bool) {
 	return nil, true
 }
 
+// enumIntegers returns the distinct integers of the enum's fields, in declared
+// order.
+func enumIntegers(enum Enum) []int {
+	var integers []int
+	seen := make(map[int]bool)
+	for _, field := range enum.EnumFields {
+		if !seen[field.Integer] {
+			seen[field.Integer] = true
+			integers = append(integers, field.Integer)
+		}
+	}
+	return integers
+}
+
 // NoRemovingRPCs compares the current vs. updated Protolock definitions and
 // will return a list of warnings if any RPCs provided by a Service have been
 // removed. This rule is only enforced when strict mode is enabled.
 func NoRemovingRPCs(cur, upd Protolock) ([]Warning, bool) {
-	if !strict {
+	if !std.Strict {
 		return nil, true
 	}
 
+	return noRemovingRPCs(NewIndex(cur), NewIndex(upd))
+}
+
+func noRemovingRPCs(cur, upd *Index) ([]Warning, bool) {
 	var warnings []Warning
 	// check that all current Protolock services' RPCs are still in the
-	// updated Protolock
-	curServices := getServicesRPCsMap(cur)
-	updServices := getServicesRPCsMap(upd)
-
-	for path, svcMap := range curServices {
-		for svcName, rpcMap := range svcMap {
-			for rpcName := range rpcMap {
-				_, ok := updServices[path][svcName][rpcName]
-				if !ok {
-					msg := fmt.Sprintf(
-						`"%s" is missing RPC: "%s", which should be available`,
-						svcName, rpcName,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
+	// updated Protolock, which includes those of removed services
+	for _, curSvc := range cur.definedServices {
+		path := curSvc.Filepath
+		updSvc, ok := upd.matchService(curSvc)
+		if ok {
+			path = updSvc.Filepath
+		}
+
+		for _, rpc := range curSvc.Service.RPCs {
+			if ok {
+				if _, found := updSvc.RPC(rpc.Name); found {
+					continue
 				}
 			}
+
+			msg := fmt.Sprintf(
+				`"%s" is missing RPC: "%s", which should be available`,
+				curSvc.Service.Name, rpc.Name,
+			)
+			warnings = append(warnings, Warning{
+				Filepath: OSPath(path),
+				Message:  msg,
+			})
 		}
 	}
 
@@ -645,108 +840,111 @@ func NoRemovingRPCs(cur, upd Protolock) ([]Warning, bool) {
 // definitions and will return a list of warnings if any field has been removed
 // without a corresponding reservation of that field name or ID.
 func NoRemovingFieldsWithoutReserve(cur, upd Protolock) ([]Warning, bool) {
-	var warnings []Warning
+	return noRemovingFieldsWithoutReserve(NewIndex(cur), NewIndex(upd))
+}
 
-	// check all message fields
-	curFieldMap := getFieldMap(cur)
-	updFieldMap := getFieldMap(upd)
+func noRemovingFieldsWithoutReserve(cur, upd *Index) ([]Warning, bool) {
+	var warnings []Warning
 
 	// check that if a field name from the current Protolock is not retained
 	// in the updated Protolock, then the field's name and ID should become
-	// reserved within the parent message
-	for path, msgMap := range curFieldMap {
-		for msgName, fieldMap := range msgMap {
-			encounteredIDs := make(map[int]int)
-			for _, field := range updFieldMap[path][msgName] {
-				encounteredIDs[field.ID]++
+	// reserved within the parent message, or be reported if the message
+	// itself has been removed
+	for _, curMsg := range cur.definedMessages {
+		path := curMsg.Filepath
+		updMsg, ok := upd.matchMessage(curMsg)
+		if !ok {
+			updMsg = &IndexedMessage{}
+		} else {
+			path = updMsg.Filepath
+		}
+		resIDs := set(updMsg.Message.ReservedIDs)
+		resNames := set(updMsg.Message.ReservedNames)
+
+		for _, field := range curMsg.fields() {
+			if _, ok := updMsg.FieldByName(field.Name); ok {
+				continue
 			}
-			for fieldName, field := range fieldMap {
-				_, ok := updFieldMap[path][msgName][fieldName]
-				if !ok {
-					// check that the field name and ID are
-					// both in the reserved fields for this
-					// message
-					resIDsMap, resNamesMap := getReservedFields(upd)
-					if _, ok := resNamesMap[path][msgName][field.Name]; !ok {
-						msg := fmt.Sprintf(
-							`"%s" field: "%s" has been removed, but is not reserved`,
-							msgName, field.Name,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-
-					// check that the ID for this missing field is being re-used
-					// in which case will be caught by NoChangingFieldNames
-					if _, ok := encounteredIDs[field.ID]; ok {
-						continue
-					}
-
-					if _, ok := resIDsMap[path][msgName][field.ID]; !ok {
-						msg := fmt.Sprintf(
-							`"%s" ID: "%d" has been removed, but is not reserved`,
-							msgName, field.ID,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-				}
+
+			// check that the field name and ID are both in the reserved
+			// fields for this message
+			if !resNames[field.Name] {
+				msg := fmt.Sprintf(
+					`"%s" field: "%s" has been removed, but is not reserved`,
+					curMsg.local, field.Name,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
+			}
+
+			// check that the ID for this missing field is being re-used
+			// in which case will be caught by NoChangingFieldNames
+			if _, ok := updMsg.FieldByID(field.ID); ok {
+				continue
+			}
+
+			if !resIDs[field.ID] {
+				msg := fmt.Sprintf(
+					`"%s" ID: "%d" has been removed, but is not reserved`,
+					curMsg.local, field.ID,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
 			}
 		}
 	}
 
-	// check all enum fields
-	curEnumFieldMap := getEnumFieldMap(cur)
-	updEnumFieldMap := getEnumFieldMap(upd)
-
 	// check that if a field name from the current Protolock is not retained
 	// in the updated Protolock, then the field's name and integer should
 	// become reserved within the parent enum
-	for path, enumMap := range curEnumFieldMap {
-		for enumName, fieldMap := range enumMap {
-			encounteredIDs := make(map[int]int)
-			for _, field := range updEnumFieldMap[path][enumName] {
-				encounteredIDs[field.Integer]++
+	for _, curEnum := range cur.definedEnums {
+		path := curEnum.Filepath
+		updEnum, ok := upd.matchEnum(curEnum)
+		if !ok {
+			updEnum = &IndexedEnum{}
+		} else {
+			path = updEnum.Filepath
+		}
+		resIDs := set(updEnum.Enum.ReservedIDs)
+		resNames := set(updEnum.Enum.ReservedNames)
+
+		for _, field := range curEnum.Enum.EnumFields {
+			if _, ok := updEnum.ValueByName(field.Name); ok {
+				continue
 			}
-			for fieldName, field := range fieldMap {
-				_, ok := updEnumFieldMap[path][enumName][fieldName]
-				if !ok {
-					// check that the field name and ID are
-					// both in the reserved fields for this
-					// enum
-					resIDsMap, resNamesMap := getReservedEnumFields(upd)
-					if _, ok := resNamesMap[path][enumName][field.Name]; !ok {
-						msg := fmt.Sprintf(
-							`"%s" field: "%s" has been removed, but is not reserved`,
-							enumName, field.Name,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-
-					// check that the integer for this missing field is being re-used
-					// in which case will be caught by NoChangingFieldNames
-					if _, ok := encounteredIDs[field.Integer]; ok {
-						continue
-					}
-
-					if _, ok := resIDsMap[path][enumName][field.Integer]; !ok {
-						msg := fmt.Sprintf(
-							`"%s" integer: "%d" has been removed, but is not reserved`,
-							enumName, field.Integer,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-				}
+
+			// check that the field name and ID are both in the reserved
+			// fields for this enum
+			if !resNames[field.Name] {
+				msg := fmt.Sprintf(
+					`"%s" field: "%s" has been removed, but is not reserved`,
+					curEnum.Enum.Name, field.Name,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
+			}
+
+			// check that the integer for this missing field is being re-used
+			// in which case will be caught by NoChangingFieldNames
+			if len(updEnum.ValuesByNumber(field.Integer)) != 0 {
+				continue
+			}
+
+			if !resIDs[field.Integer] {
+				msg := fmt.Sprintf(
+					`"%s" integer: "%d" has been removed, but is not reserved`,
+					curEnum.Enum.Name, field.Integer,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
 			}
 		}
 	}
@@ -762,64 +960,70 @@ func NoRemovingFieldsWithoutReserve(cur, upd Protolock) ([]Warning, bool) {
 // definitions and will return a list of warnings if any RPC signature has been
 // changed while using the same name.
 func NoChangingRPCSignature(cur, upd Protolock) ([]Warning, bool) {
+	return noChangingRPCSignature(NewIndex(cur), NewIndex(upd))
+}
+
+func noChangingRPCSignature(cur, upd *Index) ([]Warning, bool) {
 	var warnings []Warning
 	// check that no breaking changes to the signature of an RPC have been
 	// made between the current Protolock and the updated Protolock
-	curRPCMap := getRPCMap(cur)
-	updRPCMap := getRPCMap(upd)
-	for path, svcMap := range curRPCMap {
-		for svcName, rpcMap := range svcMap {
-			for rpcName, rpc := range rpcMap {
-				updRPC, ok := updRPCMap[path][svcName][rpcName]
-				if !ok {
-					continue
-				}
+	for _, curSvc := range cur.definedServices {
+		updSvc, ok := upd.matchService(curSvc)
+		if !ok {
+			continue
+		}
 
-				// check that stream option and type are the same
-				// for both the RPC's request and response
-				if rpc.InStreamed != updRPC.InStreamed {
-					msg := fmt.Sprintf(
-						`"%s" RPC: "%s" input stream identifier has changed, previously: %t`,
-						svcName, rpcName, rpc.InStreamed,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+		svcName, path := curSvc.Service.Name, OSPath(updSvc.Filepath)
+		for _, rpc := range curSvc.Service.RPCs {
+			updRPC, ok := updSvc.RPC(rpc.Name)
+			if !ok {
+				continue
+			}
 
-				if rpc.OutStreamed != updRPC.OutStreamed {
-					msg := fmt.Sprintf(
-						`"%s" RPC: "%s" output stream identifier has changed, previously: %t`,
-						svcName, rpcName, rpc.OutStreamed,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+			// check that stream option and type are the same
+			// for both the RPC's request and response
+			if rpc.InStreamed != updRPC.InStreamed {
+				msg := fmt.Sprintf(
+					`"%s" RPC: "%s" input stream identifier has changed, previously: %t`,
+					svcName, rpc.Name, rpc.InStreamed,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: path,
+					Message:  msg,
+				})
+			}
 
-				if rpc.InType != updRPC.InType {
-					msg := fmt.Sprintf(
-						`"%s" RPC: "%s" input type has changed, previously: %s`,
-						svcName, rpcName, rpc.InType,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+			if rpc.OutStreamed != updRPC.OutStreamed {
+				msg := fmt.Sprintf(
+					`"%s" RPC: "%s" output stream identifier has changed, previously: %t`,
+					svcName, rpc.Name, rpc.OutStreamed,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: path,
+					Message:  msg,
+				})
+			}
 
-				if rpc.OutType != updRPC.OutType {
-					msg := fmt.Sprintf(
-						`"%s" RPC: "%s" output type has changed, previously: %s`,
-						svcName, rpcName, rpc.OutType,
-					)
-					warnings = append(warnings, Warning{
-						Filepath: OSPath(path),
-						Message:  msg,
-					})
-				}
+			if rpc.InType != updRPC.InType {
+				msg := fmt.Sprintf(
+					`"%s" RPC: "%s" input type has changed, previously: %s`,
+					svcName, rpc.Name, rpc.InType,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: path,
+					Message:  msg,
+				})
+			}
+
+			if rpc.OutType != updRPC.OutType {
+				msg := fmt.Sprintf(
+					`"%s" RPC: "%s" output type has changed, previously: %s`,
+					svcName, rpc.Name, rpc.OutType,
+				)
+				warnings = append(warnings, Warning{
+					Filepath: path,
+					Message:  msg,
+				})
 			}
 		}
 	}
@@ -831,52 +1035,51 @@ func NoChangingRPCSignature(cur, upd Protolock) ([]Warning, bool) {
 	return nil, true
 }
 
-// Existing fields must not be moved into or out of a oneof. This is a backwards-incompatible change in the Go protobuf stubs.
+// Existing fields must not be moved into or out of a oneof. This is a backwards-incompatible change in the Go protobuf stubs,
+// and is unsafe on the wire, as a reader which sees the field in a oneof clears the oneof's other members.
 // per https://google.aip.dev/180#moving-into-oneofs
 func NoMovingExistingFieldsIntoOrOutOfOneof(cur, upd Protolock) ([]Warning, bool) {
-	var warnings []Warning
+	return noMovingExistingFieldsIntoOrOutOfOneof(NewIndex(cur), NewIndex(upd))
+}
 
-	// check all message fields
-	curFieldMap := getFieldMap(cur)
-	updFieldMap := getFieldMap(upd)
+func noMovingExistingFieldsIntoOrOutOfOneof(cur, upd *Index) ([]Warning, bool) {
+	var warnings []Warning
 
 	// if a field name from the current Protolock has a OneofParent entry
 	// that differs from the updated Protolock, then a warning should be added
-	for path, msgMap := range curFieldMap {
-		for msgName, fieldMap := range msgMap {
-			for fieldName, field := range fieldMap {
-				updField, ok := updFieldMap[path][msgName][fieldName]
-				if ok && updField.OneofParent != field.OneofParent {
-					if len(updField.OneofParent) == 0 {
-						msg := fmt.Sprintf(
-							`"%s" was moved out of oneof "%s"`,
-							fieldName, field.OneofParent,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					} else if len(field.OneofParent) == 0 {
-						msg := fmt.Sprintf(
-							`"%s" was moved into oneof "%s"`,
-							fieldName, updField.OneofParent,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					} else {
-						msg := fmt.Sprintf(
-							`"%s" was moved from oneof "%s" into of oneof "%s"`,
-							fieldName, field.OneofParent, updField.OneofParent,
-						)
-						warnings = append(warnings, Warning{
-							Filepath: OSPath(path),
-							Message:  msg,
-						})
-					}
-				}
+	for _, curMsg := range cur.definedMessages {
+		updMsg, ok := upd.matchMessage(curMsg)
+		if !ok {
+			continue
+		}
+
+		for _, field := range curMsg.fields() {
+			updField, ok := updMsg.FieldByName(field.Name)
+			if !ok || updField.OneofParent == field.OneofParent {
+				continue
 			}
+
+			var msg string
+			if len(updField.OneofParent) == 0 {
+				msg = fmt.Sprintf(
+					`"%s" was moved out of oneof "%s"`,
+					field.Name, field.OneofParent,
+				)
+			} else if len(field.OneofParent) == 0 {
+				msg = fmt.Sprintf(
+					`"%s" was moved into oneof "%s"`,
+					field.Name, updField.OneofParent,
+				)
+			} else {
+				msg = fmt.Sprintf(
+					`"%s" was moved from oneof "%s" into of oneof "%s"`,
+					field.Name, field.OneofParent, updField.OneofParent,
+				)
+			}
+			warnings = append(warnings, Warning{
+				Filepath: OSPath(updMsg.Filepath),
+				Message:  msg,
+			})
 		}
 	}
 
@@ -887,338 +1090,417 @@ func NoMovingExistingFieldsIntoOrOutOfOneof(cur, upd Protolock) ([]Warning, bool
 	return nil, true
 }
 
-func getReservedFieldsRecursive(reservedIDMap lockIDsMap, reservedNameMap lockNamesMap, filepath Protopath, prefix string, msg Message) {
-	msgName := prefix + msg.Name
-	for _, id := range msg.ReservedIDs {
-		if reservedIDMap[filepath][msgName] == nil {
-			reservedIDMap[filepath][msgName] = make(map[int]int)
-		}
-		reservedIDMap[filepath][msgName][id]++
-	}
-	for _, name := range msg.ReservedNames {
-		if reservedNameMap[filepath][msgName] == nil {
-			reservedNameMap[filepath][msgName] = make(map[string]int)
-		}
-		reservedNameMap[filepath][msgName][name]++
-	}
+// NoChangingSensitiveOptions compares the current vs. updated Protolock
+// definitions and will return a list of warnings if any sensitive option (see
+// SetSensitiveOptions) on a file, message, field, enum, enum field or RPC has
+// changed value or been removed.
+func NoChangingSensitiveOptions(cur, upd Protolock) ([]Warning, bool) {
+	return checkSensitiveOptions(NewIndex(cur), NewIndex(upd))
+}
 
-	for _, msg := range msg.Messages {
-		// recursively call func, using parent message name and a '.' as prefix
-		getReservedFieldsRecursive(reservedIDMap, reservedNameMap, filepath, msgName+nestedPrefix, msg)
-	}
+// checkSensitiveOptions checks the sensitive options of the default Engine.
+func checkSensitiveOptions(cur, upd *Index) ([]Warning, bool) {
+	return noChangingSensitiveOptions(std, cur, upd)
 }
 
-// getReservedFields gets all the reserved field numbers and names, and stashes
-// them in a lockIDsMap and lockNamesMap to be checked against.
-func getReservedFields(lock Protolock) (lockIDsMap, lockNamesMap) {
-	reservedIDMap := make(lockIDsMap)
-	reservedNameMap := make(lockNamesMap)
+// sensitiveOptionsRule returns a NoChangingSensitiveOptions rule check which
+// uses the sensitive options of the Engine.
+func sensitiveOptionsRule(e *Engine) IndexRuleFunc {
+	return func(cur, upd *Index) ([]Warning, bool) {
+		return noChangingSensitiveOptions(e, cur, upd)
+	}
+}
 
-	for _, def := range lock.Definitions {
-		if reservedIDMap[def.Filepath] == nil {
-			reservedIDMap[def.Filepath] = make(map[string]map[int]int)
-		}
-		if reservedNameMap[def.Filepath] == nil {
-			reservedNameMap[def.Filepath] = make(map[string]map[string]int)
-		}
+func noChangingSensitiveOptions(e *Engine, cur, upd *Index) ([]Warning, bool) {
+	var warnings []Warning
 
-		for _, msg := range def.Def.Messages {
-			getReservedFieldsRecursive(reservedIDMap, reservedNameMap, def.Filepath, "", msg)
-		}
+	names := e.SensitiveOptions
+	if len(names) == 0 {
+		names = DefaultSensitiveOptions
 	}
 
-	return reservedIDMap, reservedNameMap
-}
+	// check that every sensitive option set in the current Protolock is still
+	// set to the same value on the same entity in the updated Protolock. If
+	// the entity itself is gone, other rules will report it. Options which do
+	// not protect the profile of the Engine are not checked.
+	check := func(path Protopath, entity string, opts, updOpts []Option) {
+		for _, opt := range opts {
+			if !containsString(names, opt.Name) ||
+				!sensitiveOptionProtects(opt.Name, e.Profile) {
+				continue
+			}
 
-func getReservedEnumFields(lock Protolock) (lockIDsMap, lockNamesMap) {
-	reservedIDMap := make(lockIDsMap)
-	reservedNameMap := make(lockNamesMap)
+			updOpt, ok := findOption(updOpts, opt.Name)
+			if !ok {
+				msg := fmt.Sprintf(
+					`%s option: "%s" has been removed, previously %s`,
+					entity, opt.Name, optionValue(opt),
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
+				continue
+			}
 
-	for _, def := range lock.Definitions {
-		if reservedIDMap[def.Filepath] == nil {
-			reservedIDMap[def.Filepath] = make(map[string]map[int]int)
+			if !equalOptions(opt, updOpt) {
+				msg := fmt.Sprintf(
+					`%s option: "%s" has a different value: %s, previously %s`,
+					entity, opt.Name, optionValue(updOpt), optionValue(opt),
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(path),
+					Message:  msg,
+				})
+			}
 		}
-		if reservedNameMap[def.Filepath] == nil {
-			reservedNameMap[def.Filepath] = make(map[string]map[string]int)
+	}
+
+	for _, path := range cur.Files() {
+		if updEntry, ok := upd.File(path); ok {
+			check(path, "file", cur.files[path].Options, updEntry.Options)
 		}
+	}
 
-		for _, enum := range def.Def.Enums {
-			for _, id := range enum.ReservedIDs {
-				if reservedIDMap[def.Filepath][enum.Name] == nil {
-					reservedIDMap[def.Filepath][enum.Name] = make(map[int]int)
-				}
-				reservedIDMap[def.Filepath][enum.Name][id]++
-			}
-			for _, name := range enum.ReservedNames {
-				if reservedNameMap[def.Filepath][enum.Name] == nil {
-					reservedNameMap[def.Filepath][enum.Name] = make(map[string]int)
-				}
-				reservedNameMap[def.Filepath][enum.Name][name]++
+	for _, curMsg := range cur.definedMessages {
+		updMsg, ok := upd.matchMessage(curMsg)
+		if !ok {
+			continue
+		}
+
+		path := updMsg.Filepath
+		check(path, fmt.Sprintf(`"%s"`, curMsg.local), curMsg.Message.Options, updMsg.Message.Options)
+		for _, field := range curMsg.fields() {
+			if updField, ok := updMsg.FieldByName(field.Name); ok {
+				entity := fmt.Sprintf(`"%s" field: "%s"`, curMsg.local, field.Name)
+				check(path, entity, field.Options, updField.Options)
 			}
 		}
 	}
 
-	return reservedIDMap, reservedNameMap
-}
+	for _, curEnum := range cur.definedEnums {
+		updEnum, ok := upd.matchEnum(curEnum)
+		if !ok {
+			continue
+		}
 
-func getFieldIDNameRecursive(fieldIDNameMap lockFieldIDNameMap, filepath Protopath, prefix string, msg Message) {
-	msgName := prefix + msg.Name
-	for _, field := range msg.Fields {
-		if fieldIDNameMap[filepath][msgName] == nil {
-			fieldIDNameMap[filepath][msgName] = make(map[int]string)
+		path := updEnum.Filepath
+		check(path, fmt.Sprintf(`"%s"`, curEnum.Enum.Name), curEnum.Enum.Options, updEnum.Enum.Options)
+		for _, field := range curEnum.Enum.EnumFields {
+			if updField, ok := updEnum.ValueByName(field.Name); ok {
+				entity := fmt.Sprintf(`"%s" field: "%s"`, curEnum.Enum.Name, field.Name)
+				check(path, entity, field.Options, updField.Options)
+			}
 		}
-		fieldIDNameMap[filepath][msgName][field.ID] = field.Name
 	}
-	for _, mp := range msg.Maps {
-		if fieldIDNameMap[filepath][msgName] == nil {
-			fieldIDNameMap[filepath][msgName] = make(map[int]string)
+
+	for _, curSvc := range cur.definedServices {
+		updSvc, ok := upd.matchService(curSvc)
+		if !ok {
+			continue
+		}
+
+		for _, rpc := range curSvc.Service.RPCs {
+			if updRPC, ok := updSvc.RPC(rpc.Name); ok {
+				entity := fmt.Sprintf(`"%s" RPC: "%s"`, curSvc.Service.Name, rpc.Name)
+				check(updSvc.Filepath, entity, rpc.Options, updRPC.Options)
+			}
 		}
-		fieldIDNameMap[filepath][msgName][mp.Field.ID] = mp.Field.Name
 	}
-	for _, nestedMsg := range msg.Messages {
-		getFieldIDNameRecursive(fieldIDNameMap, filepath, msgName+nestedPrefix, nestedMsg)
+
+	if warnings != nil {
+		return warnings, false
 	}
+
+	return nil, true
 }
 
-// getFieldsIDName gets all the fields mapped by the field ID to its name for
-// all messages.
-func getFieldsIDName(lock Protolock) lockFieldIDNameMap {
-	fieldIDNameMap := make(lockFieldIDNameMap)
+// sensitiveOptionProtects reports whether checking the named option protects
+// the Profile. Every option protects the empty Profile.
+func sensitiveOptionProtects(name string, p Profile) bool {
+	profiles, ok := sensitiveOptionProfiles[name]
+	if !ok || p == "" {
+		return true
+	}
 
-	for _, def := range lock.Definitions {
-		if fieldIDNameMap[def.Filepath] == nil {
-			fieldIDNameMap[def.Filepath] = make(map[string]map[int]string)
-		}
-		for _, msg := range def.Def.Messages {
-			getFieldIDNameRecursive(fieldIDNameMap, def.Filepath, "", msg)
+	for _, op := range profiles {
+		if op == p {
+			return true
 		}
 	}
-
-	return fieldIDNameMap
+	return false
 }
 
-// getEnumFieldsIDName gets all the fields mapped by the field ID to its name
-// for all enums.
-func getEnumFieldsIDName(lock Protolock) lockFieldIDNameMap {
-	fieldIDNameMap := make(lockFieldIDNameMap)
-
-	for _, def := range lock.Definitions {
-		if fieldIDNameMap[def.Filepath] == nil {
-			fieldIDNameMap[def.Filepath] = make(map[string]map[int]string)
-		}
-		for _, enum := range def.Def.Enums {
-			for _, field := range enum.EnumFields {
-				if fieldIDNameMap[def.Filepath][enum.Name] == nil {
-					fieldIDNameMap[def.Filepath][enum.Name] = make(map[int]string)
-				}
-				fieldIDNameMap[def.Filepath][enum.Name][field.Integer] = field.Name
-			}
+// findOption returns the last option with the name, which takes effect when
+// an option is repeated.
+func findOption(opts []Option, name string) (Option, bool) {
+	for i := len(opts) - 1; i >= 0; i-- {
+		if opts[i].Name == name {
+			return opts[i], true
 		}
 	}
+	return Option{}, false
+}
 
-	return fieldIDNameMap
+// NoRemovingEnumAllowAlias compares the current vs. updated Protolock
+// definitions and will return a list of warnings if any enum which declares
+// aliased values has had its "allow_alias" option removed.
+func NoRemovingEnumAllowAlias(cur, upd Protolock) ([]Warning, bool) {
+	return noRemovingEnumAllowAlias(NewIndex(cur), NewIndex(upd))
 }
 
-func getNonReservedFieldsRecursive(nameIDMap lockNamesMap, filepath Protopath, prefix string, msg Message) {
-	msgName := prefix + msg.Name
-	for _, field := range msg.Fields {
-		if nameIDMap[filepath][msgName] == nil {
-			nameIDMap[filepath][msgName] = make(map[string]int)
+func noRemovingEnumAllowAlias(cur, upd *Index) ([]Warning, bool) {
+	var warnings []Warning
+
+	for _, curEnum := range cur.definedEnums {
+		updEnum, ok := upd.matchEnum(curEnum)
+		if !ok || !curEnum.Enum.AllowAlias || updEnum.Enum.AllowAlias {
+			continue
 		}
-		nameIDMap[filepath][msgName][field.Name] = field.ID
-	}
-	for _, mp := range msg.Maps {
-		if nameIDMap[filepath][msgName] == nil {
-			nameIDMap[filepath][msgName] = make(map[string]int)
+
+		var aliased []string
+		for _, integer := range enumIntegers(curEnum.Enum) {
+			values := curEnum.ValuesByNumber(integer)
+			if len(values) < 2 {
+				continue
+			}
+			for _, v := range values {
+				aliased = append(aliased, v.Name)
+			}
+		}
+		if aliased == nil {
+			continue
 		}
-		nameIDMap[filepath][msgName][mp.Field.Name] = mp.Field.ID
+		sort.Strings(aliased)
+
+		msg := fmt.Sprintf(
+			`"%s" has removed option: "allow_alias", but had aliased fields: "%s"`,
+			curEnum.Enum.Name, strings.Join(aliased, `", "`),
+		)
+		warnings = append(warnings, Warning{
+			Filepath: OSPath(updEnum.Filepath),
+			Message:  msg,
+		})
 	}
-	for _, nestedMsg := range msg.Messages {
-		getNonReservedFieldsRecursive(nameIDMap, filepath, msgName+nestedPrefix, nestedMsg)
+
+	if warnings != nil {
+		return warnings, false
 	}
+
+	return nil, true
 }
 
-// getNonReservedFields gets all the non-reserved field numbers and names, and
-// stashes them in a lockNamesMap to be checked against.
-func getNonReservedFields(lock Protolock) lockNamesMap {
-	nameIDMap := make(lockNamesMap)
+// NoChangingEnumAliases compares the current vs. updated Protolock definitions
+// and will return a list of warnings if any aliased enum integer has had its
+// primary name changed (while the old name remains as an alias), or had one of
+// its names removed and reserved. Names which are removed without being
+// reserved are reported by NoRemovingFieldsWithoutReserve instead. This rule
+// is only run by Compare when strict mode is enabled, see Rule.Strict.
+func NoChangingEnumAliases(cur, upd Protolock) ([]Warning, bool) {
+	return noChangingEnumAliases(NewIndex(cur), NewIndex(upd))
+}
 
-	for _, def := range lock.Definitions {
-		if nameIDMap[def.Filepath] == nil {
-			nameIDMap[def.Filepath] = make(map[string]map[string]int)
-		}
-		for _, msg := range def.Def.Messages {
-			getNonReservedFieldsRecursive(nameIDMap, def.Filepath, "", msg)
-		}
-	}
+func noChangingEnumAliases(cur, upd *Index) ([]Warning, bool) {
+	var warnings []Warning
 
-	return nameIDMap
-}
+	// only integers which are aliased in either the current or updated
+	// Protolock are checked here, plain renames are caught by
+	// NoChangingFieldNames
+	for _, curEnum := range cur.definedEnums {
+		updEnum, ok := upd.matchEnum(curEnum)
+		if !ok {
+			continue
+		}
+
+		enumName := curEnum.Enum.Name
+		resNames := set(updEnum.Enum.ReservedNames)
+		for _, integer := range enumIntegers(curEnum.Enum) {
+			names := valueNames(curEnum.ValuesByNumber(integer))
+			updNames := valueNames(updEnum.ValuesByNumber(integer))
+			if len(updNames) == 0 {
+				continue
+			}
+			if len(names) < 2 && len(updNames) < 2 {
+				continue
+			}
 
-// getNonReservedEnumFields gets all the non-reserved field numbers and names,
-// and stashes them in a lockNamesMap to be checked against.
-func getNonReservedEnumFields(lock Protolock) lockNamesMap {
-	nameIDMap := make(lockNamesMap)
+			if names[0] != updNames[0] && containsString(updNames, names[0]) {
+				msg := fmt.Sprintf(
+					`"%s" integer: %d has a new primary name: "%s", previously "%s" which remains an alias`,
+					enumName, integer, updNames[0], names[0],
+				)
+				// the old name is still accepted when parsing, and only
+				// the name written by the JSON encoding changes
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updEnum.Filepath),
+					Message:  msg,
+					Severity: SeverityWarning,
+				})
+			}
 
-	for _, def := range lock.Definitions {
-		if nameIDMap[def.Filepath] == nil {
-			nameIDMap[def.Filepath] = make(map[string]map[string]int)
-		}
-		for _, enum := range def.Def.Enums {
-			for _, field := range enum.EnumFields {
-				if nameIDMap[def.Filepath][enum.Name] == nil {
-					nameIDMap[def.Filepath][enum.Name] = make(map[string]int)
+			for _, name := range names {
+				if containsString(updNames, name) || !resNames[name] {
+					continue
 				}
-				nameIDMap[def.Filepath][enum.Name][field.Name] = field.Integer
+				msg := fmt.Sprintf(
+					`"%s" integer: %d has removed name: "%s", now only named "%s"`,
+					enumName, integer, name, strings.Join(updNames, `", "`),
+				)
+				warnings = append(warnings, Warning{
+					Filepath: OSPath(updEnum.Filepath),
+					Message:  msg,
+				})
 			}
 		}
 	}
 
-	return nameIDMap
+	if warnings != nil {
+		return warnings, false
+	}
+
+	return nil, true
 }
 
-func getMapMapRecursive(nameTypeMap lockMapMap, filepath Protopath, prefix string, msg Message) {
-	msgName := prefix + msg.Name
-	for _, mp := range msg.Maps {
-		if nameTypeMap[filepath][msgName] == nil {
-			nameTypeMap[filepath][msgName] = make(map[string]Map)
-		}
-		nameTypeMap[filepath][msgName][mp.Field.Name] = mp
+// valueNames returns the names of the enum values.
+func valueNames(values []EnumField) []string {
+	names := make([]string, 0, len(values))
+	for _, v := range values {
+		names = append(names, v.Name)
 	}
-	for _, nestedMsg := range msg.Messages {
+	return names
+}
 
-		getMapMapRecursive(nameTypeMap, filepath, msgName+nestedPrefix, nestedMsg)
-	}
+// NoChangingEnumZeroValue compares the current vs. updated Protolock
+// definitions and will return a list of warnings if the value holding integer
+// 0 in any proto3 enum has been removed, or if a proto3 enum starts with a
+// non-zero value. The zero value is the default for every unset field of the
+// enum type, so changing it changes the meaning of existing data. Enums in
+// proto2 files, whose default is their first value, and in locks which do not
+// record the syntax are not checked. Renames of the zero value are reported by
+// NoRenamingEnumZeroValue.
+func NoChangingEnumZeroValue(cur, upd Protolock) ([]Warning, bool) {
+	return noChangingEnumZeroValue(NewIndex(cur), NewIndex(upd))
 }
 
-// getMapMap gets all the map names and types, and stashes them in a
-// lockMapMap to be checked against.
-func getMapMap(lock Protolock) lockMapMap {
-	nameTypeMap := make(lockMapMap)
+func noChangingEnumZeroValue(cur, upd *Index) ([]Warning, bool) {
+	var warnings []Warning
 
-	for _, def := range lock.Definitions {
-		if nameTypeMap[def.Filepath] == nil {
-			nameTypeMap[def.Filepath] = make(map[string]map[string]Map)
-		}
-		for _, msg := range def.Def.Messages {
-			getMapMapRecursive(nameTypeMap, def.Filepath, "", msg)
+	for _, updEnum := range upd.definedEnums {
+		file, _ := upd.File(updEnum.Filepath)
+		updFields := updEnum.Enum.EnumFields
+		if file.Syntax != "proto3" || len(updFields) == 0 {
+			continue
 		}
-	}
 
-	return nameTypeMap
-}
+		enumName, path := updEnum.Enum.Name, OSPath(updEnum.Filepath)
+		curEnum, ok := cur.matchEnum(updEnum)
 
-func getFieldMapRecursive(nameTypeMap lockFieldMap, filepath Protopath, prefix string, msg Message) {
-	msgName := prefix + msg.Name
-	for _, field := range msg.Fields {
-		if nameTypeMap[filepath][msgName] == nil {
-			nameTypeMap[filepath][msgName] = make(map[string]Field)
+		// an enum without a zero value also starts with a non-zero value,
+		// which is not reported separately
+		if ok && len(curEnum.ValuesByNumber(0)) != 0 &&
+			len(updEnum.ValuesByNumber(0)) == 0 {
+			msg := fmt.Sprintf(
+				`"%s" zero value: "%s" has been removed`,
+				enumName, curEnum.ValuesByNumber(0)[0].Name,
+			)
+			warnings = append(warnings, Warning{
+				Filepath: path,
+				Message:  msg,
+			})
+			continue
 		}
-		nameTypeMap[filepath][msgName][field.Name] = field
-	}
-	for _, mp := range msg.Maps {
-		if nameTypeMap[filepath][msgName] == nil {
-			nameTypeMap[filepath][msgName] = make(map[string]Field)
+
+		updFirst := updFields[0]
+		if updFirst.Integer == 0 {
+			continue
 		}
-		nameTypeMap[filepath][msgName][mp.Field.Name] = mp.Field
-	}
-	for _, nestedMsg := range msg.Messages {
-		getFieldMapRecursive(nameTypeMap, filepath, msgName+nestedPrefix, nestedMsg)
-	}
-}
 
-// getFieldMap gets all the field names and types, and stashes them in a
-// lockFieldMap to be checked against.
-func getFieldMap(lock Protolock) lockFieldMap {
-	nameTypeMap := make(lockFieldMap)
+		msg := fmt.Sprintf(
+			`"%s" starts with a non-zero value: "%s" = %d`,
+			enumName, updFirst.Name, updFirst.Integer,
+		)
+		if ok && len(curEnum.Enum.EnumFields) != 0 &&
+			curEnum.Enum.EnumFields[0].Integer == 0 {
+			msg += fmt.Sprintf(`, previously "%s" = 0`, curEnum.Enum.EnumFields[0].Name)
+		}
+		warnings = append(warnings, Warning{
+			Filepath: path,
+			Message:  msg,
+		})
+	}
 
-	for _, def := range lock.Definitions {
-		if nameTypeMap[def.Filepath] == nil {
-			nameTypeMap[def.Filepath] = make(map[string]map[string]Field)
-		}
-		for _, msg := range def.Def.Messages {
-			getFieldMapRecursive(nameTypeMap, def.Filepath, "", msg)
-		}
+	if warnings != nil {
+		return warnings, false
 	}
 
-	return nameTypeMap
+	return nil, true
 }
 
-// getEnumFieldMap gets all the field names and types, and stashes them in a
-// lockEnumFieldMap to be checked against.
-func getEnumFieldMap(lock Protolock) lockEnumFieldMap {
-	nameTypeMap := make(lockEnumFieldMap)
+// NoRenamingEnumZeroValue compares the current vs. updated Protolock
+// definitions and will return a list of warnings if the value holding integer
+// 0 in any enum has been renamed. The name of the zero value is only used by
+// the JSON mapping and generated code, so the rule does not protect the wire
+// profile.
+func NoRenamingEnumZeroValue(cur, upd Protolock) ([]Warning, bool) {
+	return noRenamingEnumZeroValue(NewIndex(cur), NewIndex(upd))
+}
 
-	for _, def := range lock.Definitions {
-		if nameTypeMap[def.Filepath] == nil {
-			nameTypeMap[def.Filepath] = make(map[string]map[string]EnumField)
-		}
-		for _, enum := range def.Def.Enums {
-			for _, field := range enum.EnumFields {
-				if nameTypeMap[def.Filepath][enum.Name] == nil {
-					nameTypeMap[def.Filepath][enum.Name] = make(map[string]EnumField)
-				}
-				nameTypeMap[def.Filepath][enum.Name][field.Name] = field
-			}
-		}
-	}
+func noRenamingEnumZeroValue(cur, upd *Index) ([]Warning, bool) {
+	var warnings []Warning
 
-	return nameTypeMap
-}
+	for _, curEnum := range cur.definedEnums {
+		updEnum, ok := upd.matchEnum(curEnum)
+		if !ok {
+			continue
+		}
 
-// getServicesRPCsMap gets all the RPCs for the Services in a Protolock and
-// stashes them in a lockNamesMap to be checked against.
-func getServicesRPCsMap(lock Protolock) lockNamesMap {
-	servicesRPCsMap := make(lockNamesMap)
-	for _, def := range lock.Definitions {
-		if servicesRPCsMap[def.Filepath] == nil {
-			servicesRPCsMap[def.Filepath] = make(map[string]map[string]int)
+		zeros, updZeros := curEnum.ValuesByNumber(0), updEnum.ValuesByNumber(0)
+		if len(zeros) == 0 || len(updZeros) == 0 {
+			continue
 		}
-		for _, svc := range def.Def.Services {
-			if servicesRPCsMap[def.Filepath][svc.Name] == nil {
-				servicesRPCsMap[def.Filepath][svc.Name] = make(map[string]int)
-			}
-			for _, rpc := range svc.RPCs {
-				servicesRPCsMap[def.Filepath][svc.Name][rpc.Name]++
-			}
+
+		if updZeros[0].Name != zeros[0].Name {
+			msg := fmt.Sprintf(
+				`"%s" zero value: "%s" has been renamed, previously "%s"`,
+				curEnum.Enum.Name, updZeros[0].Name, zeros[0].Name,
+			)
+			warnings = append(warnings, Warning{
+				Filepath: OSPath(updEnum.Filepath),
+				Message:  msg,
+			})
 		}
 	}
 
-	return servicesRPCsMap
-}
+	if warnings != nil {
+		return warnings, false
+	}
 
-// getRPCMap gets all the RPC names and types, and stashes them in a
-// lockRPCMap to be checked against.
-func getRPCMap(lock Protolock) lockRPCMap {
-	rpcTypeMap := make(lockRPCMap)
+	return nil, true
+}
 
-	for _, def := range lock.Definitions {
-		if rpcTypeMap[def.Filepath] == nil {
-			rpcTypeMap[def.Filepath] = make(map[string]map[string]RPC)
-		}
-		for _, svc := range def.Def.Services {
-			for _, rpc := range svc.RPCs {
-				if rpcTypeMap[def.Filepath][svc.Name] == nil {
-					rpcTypeMap[def.Filepath][svc.Name] = make(map[string]RPC)
-				}
-				rpcTypeMap[def.Filepath][svc.Name][rpc.Name] = rpc
-			}
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
 		}
 	}
-
-	return rpcTypeMap
+	return false
 }
 
-func beginRuleDebug(name string) {
-	fmt.Println("RUN RULE:", name)
-}
+// optionValue formats an Option's value for use in a warning message,
+// expanding aggregated values into their text format representation.
+func optionValue(opt Option) string {
+	if opt.Aggregated == nil {
+		return opt.Value
+	}
 
-func concludeRuleDebug(name string, warnings []Warning) {
-	fmt.Println("# Warnings:", len(warnings))
-	for i, w := range warnings {
-		msg := fmt.Sprintf("%d). %s [%s]", i+1, w.Message, w.Filepath)
-		fmt.Println(msg)
+	var vals []string
+	for _, o := range opt.Aggregated {
+		if o.Name == "" {
+			vals = append(vals, optionValue(o))
+			continue
+		}
+		vals = append(vals, fmt.Sprintf("%s: %s", o.Name, optionValue(o)))
 	}
-	fmt.Println("END RULE:", name)
-	fmt.Println("===")
+	return "{" + strings.Join(vals, ", ") + "}"
 }
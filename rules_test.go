@@ -928,6 +928,208 @@ service ChannelChanger {
 }
 `
 
+const noChangingSensitiveOptionsProto = `syntax = "proto3";
+package test;
+
+option go_package = "example.com/test";
+option java_package = "com.example.test";
+
+message Channel {
+  int64 id = 1;
+  string name = 2 [json_name = "channelName"];
+  repeated int32 tags = 3 [packed = true];
+
+  message InChannel {
+    string name = 1 [json_name = "inName"];
+  }
+}
+
+enum Kind {
+  option (kind_opt) = { a: 1 };
+  UNKNOWN = 0;
+}
+
+service ChannelChanger {
+  rpc Next(Channel) returns (Channel) {
+    option (google.api.http) = { get: "/next" };
+  }
+}
+`
+
+const changingSensitiveOptionsProto = `syntax = "proto3";
+package test;
+
+option go_package = "example.com/test/v2";
+
+message Channel {
+  int64 id = 1;
+  string name = 2 [json_name = "name"];
+  repeated int32 tags = 3;
+
+  message InChannel {
+    string name = 1;
+  }
+}
+
+enum Kind {
+  option (kind_opt) = { a: 2 };
+  UNKNOWN = 0;
+}
+
+service ChannelChanger {
+  rpc Next(Channel) returns (Channel) {
+    option (google.api.http) = { get: "/v2/next" };
+  }
+}
+`
+
+const noChangingEnumAliasesProto = `syntax = "proto3";
+package test;
+
+enum Status {
+  option allow_alias = true;
+  UNKNOWN = 0;
+  STARTED = 1;
+  RUNNING = 1;
+  STOPPED = 2;
+  HALTED = 2;
+}
+
+enum Kind {
+  option allow_alias = true;
+  NONE = 0;
+  BASIC = 1;
+  SIMPLE = 1;
+}
+
+enum Plain {
+  option allow_alias = true;
+  ZERO = 0;
+  ONE = 1;
+}
+`
+
+const changingEnumAliasesProto = `syntax = "proto3";
+package test;
+
+enum Status {
+  option allow_alias = true;
+  reserved "HALTED";
+  UNKNOWN = 0;
+  ACTIVE = 1;
+  STARTED = 1;
+  RUNNING = 1;
+  STOPPED = 2;
+}
+
+enum Kind {
+  NONE = 0;
+  BASIC = 1;
+}
+
+enum Plain {
+  ZERO = 0;
+  ONE = 1;
+}
+`
+
+const noChangingEnumZeroValueProto = `syntax = "proto3";
+package test;
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STARTED = 1;
+}
+
+enum Kind {
+  KIND_UNSPECIFIED = 0;
+  BASIC = 1;
+}
+
+enum Level {
+  LEVEL_UNSPECIFIED = 0;
+  LOW = 1;
+}
+
+message Channel {
+  enum Mode {
+    MODE_UNSPECIFIED = 0;
+    ON = 1;
+  }
+}
+`
+
+const changingEnumZeroValueProto = `syntax = "proto3";
+package test;
+
+enum Status {
+  STATUS_UNKNOWN = 0;
+  STARTED = 1;
+}
+
+enum Kind {
+  BASIC = 1;
+}
+
+enum Level {
+  LOW = 1;
+  LEVEL_UNSPECIFIED = 0;
+}
+
+message Channel {
+  enum Mode {
+    MODE_UNSPECIFIED = 0;
+    ON = 1;
+  }
+}
+`
+
+const noChangingFieldWireTypesProto = `syntax = "proto3";
+package test;
+
+enum Status {
+  UNKNOWN = 0;
+}
+
+message Channel {
+  int32 id = 1;
+  sint32 offset = 2;
+  fixed32 hash = 3;
+  string name = 4;
+  Status status = 5;
+  Status other = 6;
+  int64 count = 7;
+  map<int32, string> labels = 8;
+  int32 nested = 9;
+}
+`
+
+const changingFieldWireTypesProto = `syntax = "proto3";
+package test;
+
+enum Status {
+  UNKNOWN = 0;
+}
+
+message Detail {}
+
+message Other {
+  message Status {}
+}
+
+message Channel {
+  .test.Status id = 1;
+  int32 offset = 2;
+  sfixed32 hash = 3;
+  bytes name = 4;
+  Detail status = 5;
+  uint64 other = 6;
+  sint64 count = 7;
+  map<uint32, string> labels = 8;
+  Other.Status nested = 9;
+}
+`
+
 func TestParseOnReader(t *testing.T) {
 	r := strings.NewReader(simpleProto)
 	_, err := Parse("simpleProto", r)
@@ -1000,6 +1202,80 @@ func TestChangingFieldTypes(t *testing.T) {
 	assert.Len(t, warnings, 0)
 }
 
+func TestChangingFieldWireTypes(t *testing.T) {
+	SetDebug(true)
+	curLock := parseTestProto(t, noChangingFieldWireTypesProto)
+	updLock := parseTestProto(t, changingFieldWireTypesProto)
+
+	// with the default profile every type change is an error
+	warnings, ok := NoChangingFieldTypes(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 9)
+	for _, w := range warnings {
+		assert.Equal(t, SeverityError, w.Severity, w.Message)
+	}
+
+	// wire-compatible changes are only warnings when the wire profile is
+	// selected
+	wire := NewEngine(EngineOptions{Profile: ProfileWire})
+	warnings, ok = fieldTypesRule(wire)(NewIndex(curLock), NewIndex(updLock))
+	assert.False(t, ok)
+	assert.Len(t, warnings, 9)
+	orderByPathAndMessage(warnings)
+
+	// "nested" refers to a message named "Status", not to the enum
+	expected := []struct {
+		message  string
+		severity Severity
+	}{
+		{`"Channel" field: "count" has a different type: sint64, previously int64 (breaking, existing values cannot be read)`, SeverityError},
+		{`"Channel" field: "hash" has a different type: sfixed32, previously fixed32 (wire-compatible, but values may be truncated or reinterpreted)`, SeverityWarning},
+		{`"Channel" field: "id" has a different type: .test.Status, previously int32 (wire-compatible, but values may be truncated or reinterpreted)`, SeverityWarning},
+		{`"Channel" field: "labels" has a different type: uint32, previously int32 (wire-compatible, but values may be truncated or reinterpreted)`, SeverityWarning},
+		{`"Channel" field: "name" has a different type: bytes, previously string (wire-compatible only if all values are valid UTF-8)`, SeverityWarning},
+		{`"Channel" field: "nested" has a different type: Other.Status, previously int32 (breaking, existing values cannot be read)`, SeverityError},
+		{`"Channel" field: "offset" has a different type: int32, previously sint32 (breaking, existing values cannot be read)`, SeverityError},
+		{`"Channel" field: "other" has a different type: uint64, previously Status (wire-compatible, but values may be truncated or reinterpreted)`, SeverityWarning},
+		{`"Channel" field: "status" has a different type: Detail, previously Status (breaking, existing values cannot be read)`, SeverityError},
+	}
+	for i, e := range expected {
+		assert.Equal(t, e.message, warnings[i].Message)
+		assert.Equal(t, e.severity, warnings[i].Severity)
+	}
+
+	// wire-compatible changes still break the JSON mapping and generated
+	// code, so they are errors unless only the wire profile is enforced
+	for _, p := range []Profile{"", ProfileWire, ProfileJSON, ProfileSource} {
+		engine := NewEngine(EngineOptions{Profile: p})
+		report, _ := engine.Compare(curLock, updLock)
+
+		var errors int
+		for _, w := range report.Warnings {
+			if w.RuleName == "NoChangingFieldTypes" && w.IsError() {
+				errors++
+			}
+		}
+		if p == ProfileWire {
+			assert.Equal(t, 4, errors, p)
+		} else {
+			assert.Equal(t, 9, errors, p)
+		}
+	}
+}
+
+func TestClassifyTypeChange(t *testing.T) {
+	assert.Equal(t, typeChangeWireCompatible, classifyTypeChange("int32", "int64"))
+	assert.Equal(t, typeChangeWireCompatible, classifyTypeChange("bool", "enum"))
+	assert.Equal(t, typeChangeWireCompatible, classifyTypeChange("sint32", "sint64"))
+	assert.Equal(t, typeChangeWireCompatible, classifyTypeChange("fixed64", "sfixed64"))
+	assert.Equal(t, typeChangeConditional, classifyTypeChange("string", "bytes"))
+	assert.Equal(t, typeChangeConditional, classifyTypeChange("bytes", "string"))
+	assert.Equal(t, typeChangeBreaking, classifyTypeChange("sint32", "int32"))
+	assert.Equal(t, typeChangeBreaking, classifyTypeChange("fixed32", "fixed64"))
+	assert.Equal(t, typeChangeBreaking, classifyTypeChange("enum", "Message"))
+	assert.Equal(t, typeChangeBreaking, classifyTypeChange("string", "int32"))
+}
+
 func TestChangingFieldTypesNestedMessages(t *testing.T) {
 	SetDebug(true)
 	curLock := parseTestProto(t, noChangingFieldTypesNestedMessageProto)
@@ -1137,6 +1413,284 @@ func TestMovingFieldIntoOrOutOfOneof(t *testing.T) {
 	assert.False(t, ok)
 	assert.Len(t, warnings, 1)
 	assert.Equal(t, "\"id\" was moved out of oneof \"test_oneof\"", warnings[0].Message)
+
+	// a reader which sees the field in the oneof clears its other members,
+	// so the move is unsafe on the wire too
+	for _, p := range Profiles {
+		report, _ := NewEngine(EngineOptions{Profile: p}).Compare(curLock, updLock)
+		assert.Equal(t, 1, countRule(report.Warnings, "NoMovingExistingFieldsIntoOrOutOfOneof"), p)
+	}
+}
+
+func TestChangingSensitiveOptions(t *testing.T) {
+	SetDebug(true)
+	curLock := parseTestProto(t, noChangingSensitiveOptionsProto)
+	updLock := parseTestProto(t, changingSensitiveOptionsProto)
+
+	warnings, ok := NoChangingSensitiveOptions(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 5)
+
+	warnings, ok = NoChangingSensitiveOptions(updLock, updLock)
+	assert.True(t, ok)
+	assert.Len(t, warnings, 0)
+
+	SetSensitiveOptions([]string{"(kind_opt)", " (google.api.http)"})
+	defer SetSensitiveOptions(nil)
+
+	warnings, ok = NoChangingSensitiveOptions(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 2)
+	orderByPathAndMessage(warnings)
+	assert.Equal(t, `"ChannelChanger" RPC: "Next" option: "(google.api.http)" has a different value: {get: /v2/next}, previously {get: /next}`, warnings[0].Message)
+	assert.Equal(t, `"Kind" option: "(kind_opt)" has a different value: {a: 2}, previously {a: 1}`, warnings[1].Message)
+}
+
+func TestChangingSensitiveOptionsByProfile(t *testing.T) {
+	curLock := parseTestProto(t, noChangingSensitiveOptionsProto)
+	updLock := parseTestProto(t, changingSensitiveOptionsProto)
+
+	// each default option only protects the profiles it affects, e.g. a
+	// changed "go_package" does not break the wire format
+	tests := []struct {
+		profile  Profile
+		expected []string
+	}{
+		{
+			profile: ProfileWire,
+			expected: []string{
+				`"Channel" field: "tags" option: "packed" has been removed, previously true`,
+			},
+		},
+		{
+			profile: ProfileJSON,
+			expected: []string{
+				`"Channel" field: "name" option: "json_name" has a different value: name, previously channelName`,
+				`"Channel.InChannel" field: "name" option: "json_name" has been removed, previously inName`,
+			},
+		},
+		{
+			profile: ProfileSource,
+			expected: []string{
+				`file option: "go_package" has a different value: example.com/test/v2, previously example.com/test`,
+				`file option: "java_package" has been removed, previously com.example.test`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		engine := NewEngine(EngineOptions{Profile: test.profile})
+		warnings, _ := sensitiveOptionsRule(engine)(NewIndex(curLock), NewIndex(updLock))
+		orderByPathAndMessage(warnings)
+
+		var messages []string
+		for _, w := range warnings {
+			messages = append(messages, w.Message)
+		}
+		assert.Equal(t, test.expected, messages, test.profile)
+	}
+
+	// options which are not defaults protect every profile
+	engine := NewEngine(EngineOptions{
+		Profile:          ProfileWire,
+		SensitiveOptions: []string{"(kind_opt)"},
+	})
+	warnings, _ := sensitiveOptionsRule(engine)(NewIndex(curLock), NewIndex(updLock))
+	assert.Len(t, warnings, 1)
+}
+
+func TestChangingSensitiveEnumAndRPCOptions(t *testing.T) {
+	SetDebug(true)
+	curLock := parseTestProto(t, `syntax = "proto3";
+package test;
+
+enum Kind {
+  option deprecated = true;
+  UNKNOWN = 0;
+  OLD = 1 [deprecated = true];
+}
+
+service ChannelChanger {
+  rpc Next(Channel) returns (Channel) {
+    option idempotency_level = NO_SIDE_EFFECTS;
+  }
+}
+`)
+	updLock := parseTestProto(t, `syntax = "proto3";
+package test;
+
+enum Kind {
+  UNKNOWN = 0 [deprecated = true];
+  OLD = 1;
+}
+
+service ChannelChanger {
+  rpc Next(Channel) returns (Channel) {
+    option idempotency_level = IDEMPOTENT;
+  }
+}
+`)
+
+	// options which are added, such as the deprecation of "UNKNOWN", are
+	// not reported
+	warnings, ok := NoChangingSensitiveOptions(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 3)
+	orderByPathAndMessage(warnings)
+	assert.Equal(t, `"ChannelChanger" RPC: "Next" option: "idempotency_level" has a different value: IDEMPOTENT, previously NO_SIDE_EFFECTS`, warnings[0].Message)
+	assert.Equal(t, `"Kind" field: "OLD" option: "deprecated" has been removed, previously true`, warnings[1].Message)
+	assert.Equal(t, `"Kind" option: "deprecated" has been removed, previously true`, warnings[2].Message)
+}
+
+func TestRemovingEnumAllowAlias(t *testing.T) {
+	SetDebug(true)
+	curLock := parseTestProto(t, noChangingEnumAliasesProto)
+	updLock := parseTestProto(t, changingEnumAliasesProto)
+
+	warnings, ok := NoRemovingEnumAllowAlias(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, `"Kind" has removed option: "allow_alias", but had aliased fields: "BASIC", "SIMPLE"`, warnings[0].Message)
+
+	warnings, ok = NoRemovingEnumAllowAlias(updLock, updLock)
+	assert.True(t, ok)
+	assert.Len(t, warnings, 0)
+}
+
+func TestChangingEnumAliases(t *testing.T) {
+	SetDebug(true)
+	curLock := parseTestProto(t, noChangingEnumAliasesProto)
+	updLock := parseTestProto(t, changingEnumAliasesProto)
+
+	warnings, ok := NoChangingEnumAliases(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 2)
+	orderByPathAndMessage(warnings)
+	assert.Equal(t, `"Status" integer: 1 has a new primary name: "ACTIVE", previously "STARTED" which remains an alias`, warnings[0].Message)
+	assert.Equal(t, `"Status" integer: 2 has removed name: "HALTED", now only named "STOPPED"`, warnings[1].Message)
+
+	warnings, ok = NoChangingEnumAliases(updLock, updLock)
+	assert.True(t, ok)
+	assert.Len(t, warnings, 0)
+
+	// the unreserved removal of "SIMPLE" is only reported by
+	// NoRemovingFieldsWithoutReserve, and the aliased integers are not
+	// reported by NoChangingFieldNames
+	warnings, _ = NoRemovingFieldsWithoutReserve(curLock, updLock)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, `"Kind" field: "SIMPLE" has been removed, but is not reserved`, warnings[0].Message)
+
+	warnings, ok = NoChangingFieldNames(curLock, updLock)
+	assert.True(t, ok)
+	assert.Len(t, warnings, 0)
+}
+
+func TestParseEnumAllowAlias(t *testing.T) {
+	lock := parseTestProto(t, `syntax = "proto3";
+package test;
+
+enum On {
+  option allow_alias = True;
+  A = 0;
+  B = 0;
+}
+
+enum Off {
+  option allow_alias = true;
+  option allow_alias = false;
+  C = 0;
+}
+`)
+
+	enums := lock.Definitions[0].Def.Enums
+	assert.True(t, enums[0].AllowAlias)
+	assert.False(t, enums[1].AllowAlias)
+}
+
+func TestChangingEnumZeroValue(t *testing.T) {
+	SetDebug(true)
+	curLock := parseTestProto(t, noChangingEnumZeroValueProto)
+	updLock := parseTestProto(t, changingEnumZeroValueProto)
+
+	// removing the zero value is reported once, although the enum then
+	// also starts with a non-zero value
+	warnings, ok := NoChangingEnumZeroValue(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 2)
+	orderByPathAndMessage(warnings)
+	assert.Equal(t, `"Kind" zero value: "KIND_UNSPECIFIED" has been removed`, warnings[0].Message)
+	assert.Equal(t, `"Level" starts with a non-zero value: "LOW" = 1, previously "LEVEL_UNSPECIFIED" = 0`, warnings[1].Message)
+
+	// an enum which starts with a non-zero value is reported whether or not
+	// it did before, or is new
+	warnings, ok = NoChangingEnumZeroValue(updLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 2)
+	orderByPathAndMessage(warnings)
+	assert.Equal(t, `"Kind" starts with a non-zero value: "BASIC" = 1`, warnings[0].Message)
+	assert.Equal(t, `"Level" starts with a non-zero value: "LOW" = 1`, warnings[1].Message)
+
+	warnings, ok = NoChangingEnumZeroValue(Protolock{}, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 2)
+
+	warnings, ok = NoChangingEnumZeroValue(curLock, curLock)
+	assert.True(t, ok)
+	assert.Len(t, warnings, 0)
+}
+
+func TestChangingProto2EnumZeroValue(t *testing.T) {
+	SetDebug(true)
+	proto2 := func(proto string) string {
+		return strings.Replace(proto, `syntax = "proto3";`, `syntax = "proto2";`, 1)
+	}
+	curLock := parseTestProto(t, proto2(noChangingEnumZeroValueProto))
+	updLock := parseTestProto(t, proto2(changingEnumZeroValueProto))
+
+	// the default of a proto2 enum is its first value, which may be non-zero
+	warnings, ok := NoChangingEnumZeroValue(curLock, updLock)
+	assert.True(t, ok)
+	assert.Len(t, warnings, 0)
+
+	// locks which do not record the syntax are not checked
+	for i := range updLock.Definitions {
+		updLock.Definitions[i].Def.Syntax = ""
+	}
+	warnings, ok = NoChangingEnumZeroValue(curLock, updLock)
+	assert.True(t, ok)
+	assert.Len(t, warnings, 0)
+}
+
+func TestRenamingEnumZeroValue(t *testing.T) {
+	SetDebug(true)
+	curLock := parseTestProto(t, noChangingEnumZeroValueProto)
+	updLock := parseTestProto(t, changingEnumZeroValueProto)
+
+	warnings, ok := NoRenamingEnumZeroValue(curLock, updLock)
+	assert.False(t, ok)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, `"Status" zero value: "STATUS_UNKNOWN" has been renamed, previously "STATUS_UNSPECIFIED"`, warnings[0].Message)
+
+	warnings, ok = NoRenamingEnumZeroValue(updLock, updLock)
+	assert.True(t, ok)
+	assert.Len(t, warnings, 0)
+
+	// the rename is not also reported as a changed field name
+	_, ok = WithIndex(noChangingFieldNames)(curLock, updLock)
+	assert.True(t, ok)
+
+	// the name of the zero value is not part of the wire format
+	for _, p := range []Profile{ProfileWire, ProfileJSON, ProfileSource} {
+		report, _ := NewEngine(EngineOptions{Profile: p}).Compare(curLock, updLock)
+		assert.Equal(t, 2, countRule(report.Warnings, "NoChangingEnumZeroValue"), p)
+
+		renames := countRule(report.Warnings, "NoRenamingEnumZeroValue")
+		if p == ProfileWire {
+			assert.Equal(t, 0, renames, p)
+		} else {
+			assert.Equal(t, 1, renames, p)
+		}
+	}
 }
 
 func parseTestProto(t *testing.T, proto string) Protolock {
@@ -0,0 +1,346 @@
+package protolock
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockLayout selects how a Protolock is stored in proto.lock files.
+type LockLayout string
+
+const (
+	// LayoutSingle stores the Protolock in a single proto.lock file in the
+	// lock directory, and is the default.
+	LayoutSingle LockLayout = ""
+	// LayoutDirectory stores the definitions of the proto files in each
+	// directory in a shard of their own.
+	LayoutDirectory LockLayout = "directory"
+	// LayoutPackage stores the definitions of the proto files of each package
+	// in a shard of their own.
+	LayoutPackage LockLayout = "package"
+)
+
+// ShardDirName is the name of the directory, within the lock directory, which
+// contains the shards of a sharded LockLayout. Each shard is a proto.lock file
+// at the path of its directory or package name within it, e.g.
+// "proto.lock.d/api/v1/proto.lock" or "proto.lock.d/acme.api.v1/proto.lock".
+const ShardDirName = "proto.lock.d"
+
+// ParseLockLayout returns the LockLayout named by s, which is one of "single"
+// (or empty), "directory" or "package".
+func ParseLockLayout(s string) (LockLayout, error) {
+	switch LockLayout(s) {
+	case LayoutSingle, "single":
+		return LayoutSingle, nil
+	case LayoutDirectory, LayoutPackage:
+		return LockLayout(s), nil
+	}
+
+	return "", fmt.Errorf(
+		"unknown lock layout: %q, must be one of: single, directory, package", s,
+	)
+}
+
+// ShardDir returns the directory containing the shards of a sharded layout.
+func (cfg *Config) ShardDir() string {
+	return filepath.Join(cfg.LockDir, ShardDirName)
+}
+
+// shardKey returns the directory or package of the definition, which selects
+// its shard.
+func (cfg *Config) shardKey(def Definition) string {
+	if cfg.Layout == LayoutPackage {
+		return def.Def.Package.Name
+	}
+
+	dir := path.Dir(strings.Replace(string(def.Filepath), ProtoSep, "/", -1))
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// shardPath returns the path of the shard which stores the definition.
+func (cfg *Config) shardPath(def Definition) string {
+	return filepath.Join(
+		cfg.ShardDir(), filepath.FromSlash(cfg.shardKey(def)), LockFileName,
+	)
+}
+
+// lockFiles splits the Protolock into the proto.lock files of the layout,
+// keyed by path.
+func (cfg *Config) lockFiles(lock Protolock) map[string]Protolock {
+	if cfg.Layout == LayoutSingle {
+		return map[string]Protolock{cfg.LockFilePath(): lock}
+	}
+
+	files := make(map[string]Protolock)
+	for _, def := range lock.Definitions {
+		name := cfg.shardPath(def)
+		shard := files[name]
+		shard.Version = lock.Version
+		shard.Definitions = append(shard.Definitions, def)
+		files[name] = shard
+	}
+
+	// a lock without definitions is stored in an empty shard, so that it
+	// still exists
+	if len(files) == 0 {
+		name := filepath.Join(cfg.ShardDir(), LockFileName)
+		files[name] = Protolock{Version: lock.Version}
+	}
+
+	return files
+}
+
+// lockFilePaths returns the paths of the existing proto.lock files of the
+// layout. When there are none, but the proto.lock files of another layout
+// exist, those are returned so that the Protolock can be read, and they are
+// replaced by the files of the layout when saved.
+func (cfg *Config) lockFilePaths() ([]string, error) {
+	shards, err := cfg.shardPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(cfg.LockFilePath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	single := err == nil
+
+	switch {
+	case cfg.Layout == LayoutSingle && single:
+		return []string{cfg.LockFilePath()}, nil
+	case cfg.Layout != LayoutSingle && len(shards) != 0:
+		return shards, nil
+	case single:
+		return []string{cfg.LockFilePath()}, nil
+	default:
+		return shards, nil
+	}
+}
+
+// allLockFilePaths returns the paths of the existing proto.lock files of
+// every layout, which are removed by SaveLock unless they belong to the
+// cfg's Layout.
+func (cfg *Config) allLockFilePaths() ([]string, error) {
+	paths, err := cfg.shardPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(cfg.LockFilePath())
+	if err == nil {
+		paths = append(paths, cfg.LockFilePath())
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// shardPaths returns the paths of the existing shards, in order.
+func (cfg *Config) shardPaths() ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(cfg.ShardDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == cfg.ShardDir() {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() && d.Name() == LockFileName {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ReadLock reads the current Protolock from the proto.lock files of the cfg's
+// Layout, assembling the shards of a sharded layout into one Protolock.
+// ErrLockNotFound is returned if there are no proto.lock files. Lock files are
+// always read from the OS file system at the cfg's LockDir, even when proto
+// files are read from the cfg's ProtoFS.
+func ReadLock(cfg Config) (Protolock, error) {
+	paths, err := cfg.lockFilePaths()
+	if err != nil {
+		return Protolock{}, err
+	}
+	if len(paths) == 0 {
+		return Protolock{}, ErrLockNotFound
+	}
+
+	lock := Protolock{Version: LockVersion}
+	for _, path := range paths {
+		shard, err := readLockFile(path)
+		if err != nil {
+			return Protolock{}, err
+		}
+		lock.Definitions = append(lock.Definitions, shard.Definitions...)
+	}
+
+	return lock, nil
+}
+
+// readChangedShards reads the current Protolock to compare with the updated
+// Protolock, like ReadLock, but only decodes the shards of a sharded layout
+// which are affected by changes to the proto files. A shard is unchanged when
+// its proto.lock file is identical to the encoding of the updated definitions
+// it stores, so the current definitions of its proto files are those of the
+// updated Protolock, and are taken from it instead. The paths of the proto
+// files stored by unchanged shards are returned, and are empty unless the
+// cfg's Layout is sharded and its shards exist.
+func readChangedShards(
+	cfg Config, updated Protolock,
+) (Protolock, map[Protopath]bool, error) {
+	paths, err := cfg.lockFilePaths()
+	if err != nil {
+		return Protolock{}, nil, err
+	}
+	if cfg.Layout == LayoutSingle || len(paths) == 0 ||
+		paths[0] == cfg.LockFilePath() {
+		lock, err := ReadLock(cfg)
+		return lock, nil, err
+	}
+
+	files := cfg.lockFiles(updated)
+	lock := Protolock{Version: LockVersion}
+	unchanged := make(map[Protopath]bool)
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Protolock{}, nil, err
+		}
+
+		if shard, ok := files[path]; ok {
+			enc, err := MarshalLock(shard)
+			if err != nil {
+				return Protolock{}, nil, err
+			}
+			if bytes.Equal(b, enc) {
+				for _, def := range shard.Definitions {
+					unchanged[def.Filepath] = true
+				}
+				lock.Definitions = append(lock.Definitions, shard.Definitions...)
+				continue
+			}
+		}
+
+		shard, err := decodeLockFile(path, b)
+		if err != nil {
+			return Protolock{}, nil, err
+		}
+		lock.Definitions = append(lock.Definitions, shard.Definitions...)
+	}
+
+	return lock, unchanged, nil
+}
+
+// splitDefinitions splits the definitions of the Protolock into those of the
+// proto files at the given paths, and the rest.
+func splitDefinitions(
+	lock Protolock, paths map[Protopath]bool,
+) (in, out Protolock) {
+	in.Version, out.Version = lock.Version, lock.Version
+	for _, def := range lock.Definitions {
+		if paths[def.Filepath] {
+			in.Definitions = append(in.Definitions, def)
+		} else {
+			out.Definitions = append(out.Definitions, def)
+		}
+	}
+	return in, out
+}
+
+// readLockFile reads the Protolock in the proto.lock file at path.
+func readLockFile(path string) (Protolock, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Protolock{}, err
+	}
+	return decodeLockFile(path, b)
+}
+
+// decodeLockFile decodes the Protolock in the contents of the proto.lock file
+// at path.
+func decodeLockFile(path string, b []byte) (Protolock, error) {
+	lock, err := FromReader(bytes.NewReader(b))
+	if err != nil {
+		return Protolock{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return lock, nil
+}
+
+// SaveLock writes the Protolock to the proto.lock files of the cfg's Layout,
+// in the encoding of WriteLock. In a sharded layout, only the shards whose
+// contents change are written, and shards which no longer contain definitions
+// are removed. The proto.lock files of any other layout are removed, so that
+// changing the layout replaces them.
+func SaveLock(cfg Config, lock Protolock) error {
+	existing, err := cfg.allLockFilePaths()
+	if err != nil {
+		return err
+	}
+
+	files := cfg.lockFiles(lock)
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		b, err := MarshalLock(files[path])
+		if err != nil {
+			return err
+		}
+
+		current, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(current, b) {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, b, 0666); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range existing {
+		if _, ok := files[path]; ok {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		cfg.removeEmptyShardDirs(filepath.Dir(path))
+	}
+
+	return nil
+}
+
+// removeEmptyShardDirs removes dir and its parents, up to and including the
+// shard directory, while they are empty.
+func (cfg *Config) removeEmptyShardDirs(dir string) {
+	for dir == cfg.ShardDir() ||
+		strings.HasPrefix(dir, cfg.ShardDir()+string(filepath.Separator)) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,242 @@
+package protolock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLockLayout(t *testing.T) {
+	for s, want := range map[string]LockLayout{
+		"":          LayoutSingle,
+		"single":    LayoutSingle,
+		"directory": LayoutDirectory,
+		"package":   LayoutPackage,
+	} {
+		layout, err := ParseLockLayout(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, layout)
+	}
+
+	_, err := ParseLockLayout("file")
+	assert.Error(t, err)
+}
+
+func shardTestLock(t *testing.T) Protolock {
+	var lock Protolock
+	for _, path := range []Protopath{
+		"a.proto", "api:/:v1:/:b.proto", "api:/:v1:/:c.proto", "api:/:v2:/:d.proto",
+	} {
+		def := parseTestProto(t, simpleProto).Definitions[0]
+		def.Filepath = path
+		if strings.Contains(string(path), "v2") {
+			def.Def.Package.Name = "api.v2"
+		}
+		lock.Definitions = append(lock.Definitions, def)
+	}
+	return lock
+}
+
+func TestSaveLockDirectoryLayout(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := NewConfig(dir, dir, ignoreArg, false, false)
+	require.NoError(t, err)
+
+	// a proto.lock file of the single layout is replaced by shards
+	lock := shardTestLock(t)
+	require.NoError(t, SaveLock(*cfg, lock))
+	assert.FileExists(t, cfg.LockFilePath())
+
+	cfg.Layout = LayoutDirectory
+	require.NoError(t, SaveLock(*cfg, lock))
+	assert.NoFileExists(t, cfg.LockFilePath())
+	assert.True(t, cfg.LockFileExists())
+
+	paths, err := cfg.lockFilePaths()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(cfg.ShardDir(), "api", "v1", LockFileName),
+		filepath.Join(cfg.ShardDir(), "api", "v2", LockFileName),
+		filepath.Join(cfg.ShardDir(), LockFileName),
+	}, paths)
+
+	read, err := ReadLock(*cfg)
+	require.NoError(t, err)
+	assert.True(t, read.Equal(&lock))
+
+	// only shards which change are written
+	unchanged := time.Now().Add(-time.Hour)
+	for _, path := range paths {
+		require.NoError(t, os.Chtimes(path, unchanged, unchanged))
+	}
+	lock.Definitions[0].Def.Messages[0].Name = "Renamed"
+	lock.Definitions = lock.Definitions[:3]
+	require.NoError(t, SaveLock(*cfg, lock))
+
+	info, err := os.Stat(paths[0])
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(unchanged))
+	info, err = os.Stat(paths[2])
+	require.NoError(t, err)
+	assert.False(t, info.ModTime().Equal(unchanged))
+
+	// shards without definitions are removed, with their directories
+	assert.NoDirExists(t, filepath.Join(cfg.ShardDir(), "api", "v2"))
+
+	read, err = ReadLock(*cfg)
+	require.NoError(t, err)
+	assert.True(t, read.Equal(&lock))
+}
+
+func TestSaveLockPackageLayout(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := NewConfig(dir, dir, ignoreArg, false, false)
+	require.NoError(t, err)
+	cfg.Layout = LayoutPackage
+
+	_, err = ReadLock(*cfg)
+	assert.Equal(t, ErrLockNotFound, err)
+	assert.False(t, cfg.LockFileExists())
+
+	lock := shardTestLock(t)
+	require.NoError(t, SaveLock(*cfg, lock))
+	assert.FileExists(t, filepath.Join(cfg.ShardDir(), "test", LockFileName))
+	assert.FileExists(t, filepath.Join(cfg.ShardDir(), "api.v2", LockFileName))
+
+	read, err := ReadLock(*cfg)
+	require.NoError(t, err)
+	assert.True(t, read.Equal(&lock))
+}
+
+func TestSaveLockSingleLayoutRemovesShards(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := NewConfig(dir, dir, ignoreArg, false, false)
+	require.NoError(t, err)
+	cfg.Layout = LayoutDirectory
+
+	lock := shardTestLock(t)
+	require.NoError(t, SaveLock(*cfg, lock))
+	assert.DirExists(t, cfg.ShardDir())
+
+	// switching back to the single layout reads the shards, and replaces
+	// them with a proto.lock file
+	cfg.Layout = LayoutSingle
+	assert.True(t, cfg.LockFileExists())
+	read, err := ReadLock(*cfg)
+	require.NoError(t, err)
+	assert.True(t, read.Equal(&lock))
+
+	require.NoError(t, SaveLock(*cfg, read))
+	assert.FileExists(t, cfg.LockFilePath())
+	assert.NoDirExists(t, cfg.ShardDir())
+
+	read, err = ReadLock(*cfg)
+	require.NoError(t, err)
+	assert.True(t, read.Equal(&lock))
+}
+
+func TestReadLockMalformedShard(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := NewConfig(dir, dir, ignoreArg, false, false)
+	require.NoError(t, err)
+	cfg.Layout = LayoutPackage
+	require.NoError(t, SaveLock(*cfg, shardTestLock(t)))
+
+	path := filepath.Join(cfg.ShardDir(), "test", LockFileName)
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": -1}`), 0644))
+
+	_, err = ReadLock(*cfg)
+	assert.ErrorIs(t, err, ErrMalformedLock)
+	assert.Contains(t, err.Error(), path)
+}
+
+func TestFromReaderSingleDocument(t *testing.T) {
+	a, err := MarshalLock(shardTestLock(t))
+	require.NoError(t, err)
+
+	// concatenated Protolocks are only assembled from the shards read by
+	// ReadLock
+	_, err = FromReader(strings.NewReader(string(a) + unversionedLock))
+	assert.Error(t, err)
+
+	lock, err := FromReader(strings.NewReader(string(a)))
+	require.NoError(t, err)
+	assert.Len(t, lock.Definitions, 4)
+}
+
+func TestStatusChangedShards(t *testing.T) {
+	dir := t.TempDir()
+	protos := fstest.MapFS{
+		"acme/v1/order.proto":      {Data: []byte(orderProto)},
+		"acme/type/money.proto":    {Data: []byte(moneyProto)},
+		"acme/type/currency.proto": {Data: []byte(currencyProto)},
+	}
+	cfg := Config{
+		LockDir:   dir,
+		ProtoRoot: dir,
+		ProtoFS:   protos,
+		Layout:    LayoutDirectory,
+	}
+
+	lock, err := getUpdatedLock(context.Background(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, SaveLock(cfg, *lock))
+
+	// a shard whose proto files are unchanged is not decoded, and its
+	// definitions are taken from the proto files
+	protos["acme/v1/order.proto"] = &fstest.MapFile{Data: []byte(
+		strings.Replace(orderProto, "acme.type.Money", ".acme.type.Money", 1),
+	)}
+	updated, err := getUpdatedLock(context.Background(), cfg)
+	require.NoError(t, err)
+
+	current, unchanged, err := readChangedShards(cfg, *updated)
+	require.NoError(t, err)
+	assert.Equal(t, map[Protopath]bool{
+		"acme:/:type:/:currency.proto": true,
+		"acme:/:type:/:money.proto":    true,
+	}, unchanged)
+	assert.True(t, current.Equal(lock))
+
+	// the types defined by unchanged shards are resolved, but only the
+	// changed shards are compared, and the report has the whole Protolocks
+	report, err := Status(cfg)
+	require.NoError(t, err)
+	assert.Empty(t, report.Warnings)
+	assert.True(t, report.Current.Equal(lock))
+	assert.True(t, report.Updated.Equal(updated))
+
+	protos["acme/v1/order.proto"] = &fstest.MapFile{Data: []byte(
+		strings.Replace(orderProto, "acme.type.Money", "acme.type.Currency", 1),
+	)}
+	report, err = Status(cfg)
+	assert.Equal(t, ErrWarningsFound, err)
+	require.Len(t, report.Warnings, 1)
+	assert.Equal(t, OSPath("acme:/:v1:/:order.proto"), report.Warnings[0].Filepath)
+
+	// a changed shard is decoded and compared
+	protos["acme/type/currency.proto"] = &fstest.MapFile{Data: []byte(
+		strings.Replace(currencyProto, "UNKNOWN", "UNSPECIFIED", 1),
+	)}
+	protos["acme/v1/order.proto"] = &fstest.MapFile{Data: []byte(orderProto)}
+	report, err = Status(cfg)
+	assert.Equal(t, ErrWarningsFound, err)
+	require.NotEmpty(t, report.Warnings)
+	for _, warning := range report.Warnings {
+		assert.Equal(t, OSPath("acme:/:type:/:currency.proto"), warning.Filepath)
+	}
+
+	// a single proto.lock file is always decoded and compared in full
+	cfg.Layout = LayoutSingle
+	require.NoError(t, SaveLock(cfg, *lock))
+	_, unchanged, err = readChangedShards(cfg, *updated)
+	require.NoError(t, err)
+	assert.Empty(t, unchanged)
+}
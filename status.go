@@ -1,8 +1,8 @@
 package protolock
 
 import (
+	"context"
 	"errors"
-	"os"
 )
 
 // ErrOutOfDate indicates that the locked definitions are ahead or behind of
@@ -10,29 +10,52 @@ import (
 var ErrOutOfDate = errors.New("proto.lock file is not up-to-date with source")
 
 // Status will report on any issues encountered when comparing the updated tree
-// of parsed proto files and the current proto.lock file.
+// of parsed proto files and the current proto.lock file. ErrLockNotFound is
+// returned if there is no proto.lock file.
 func Status(cfg Config) (*Report, error) {
-	updated, err := getUpdatedLock(cfg)
+	return StatusContext(context.Background(), cfg)
+}
+
+// StatusContext is like Status, but stops parsing proto files and returns the
+// context's error if ctx is done.
+func StatusContext(ctx context.Context, cfg Config) (*Report, error) {
+	updated, err := getUpdatedLock(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	lockFile, err := openLockFile(cfg)
+	current, unchanged, err := readChangedShards(cfg, *updated)
 	if err != nil {
-		if os.IsNotExist(err) {
-			msg := `no "proto.lock" file found, first run "init"`
-			return nil, errors.New(msg)
-		}
 		return nil, err
 	}
-	defer lockFile.Close()
 
-	current, err := FromReader(lockFile)
-	if err != nil {
-		return nil, err
+	engine := cfg.Engine
+	if engine == nil {
+		engine = defaultEngine()
 	}
 
-	report, err := Compare(current, *updated)
+	// only the definitions of changed shards are compared, while the types
+	// defined by unchanged shards, and by files of include-only roots, are
+	// resolved by the engine, but are not compared
+	_, compared := splitDefinitions(current, unchanged)
+	resolved, updates := splitDefinitions(*updated, unchanged)
+	if cfg.hasIncludeOnlyRoots() {
+		includes, err := BuildIncludes(ctx, *updated, cfg.roots())
+		if err != nil {
+			return nil, err
+		}
+		resolved.Definitions = append(resolved.Definitions, includes.Definitions...)
+	}
+	if len(resolved.Definitions) != 0 {
+		withIncludes := *engine
+		withIncludes.Includes = resolved
+		engine = &withIncludes
+	}
+
+	report, err := engine.Compare(compared, updates)
+	if report != nil {
+		report.Current, report.Updated = current, *updated
+	}
 	if err != nil {
 		return report, err
 	}
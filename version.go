@@ -0,0 +1,67 @@
+package protolock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LockVersion is the format version of the proto.lock files written by this
+// version of protolock. It is incremented whenever the shape of a Protolock
+// changes, and a migration is added to upgrade files in the previous format.
+const LockVersion = 1
+
+// ErrUnsupportedLockVersion indicates that a proto.lock file was written in a
+// newer format than this version of protolock supports.
+var ErrUnsupportedLockVersion = errors.New("unsupported proto.lock version")
+
+// ErrMalformedLock indicates that the contents of a proto.lock file are not a
+// valid Protolock.
+var ErrMalformedLock = errors.New("malformed proto.lock")
+
+// lockMigrations upgrades a Protolock from the format version at its index to
+// the next version.
+var lockMigrations = []func(lock *Protolock) error{
+	// files without a version predate versioning, and share the format of
+	// version 1
+	func(*Protolock) error { return nil },
+}
+
+// migrateLock upgrades the Protolock to the current LockVersion.
+func migrateLock(lock *Protolock) error {
+	if lock.Version < 0 {
+		return fmt.Errorf(
+			"%w: invalid version %d", ErrMalformedLock, lock.Version,
+		)
+	}
+	if lock.Version > LockVersion {
+		return fmt.Errorf(
+			"%w: proto.lock has version %d, but protolock supports up to version %d, upgrade protolock to read it",
+			ErrUnsupportedLockVersion, lock.Version, LockVersion,
+		)
+	}
+
+	for lock.Version < LockVersion {
+		if err := lockMigrations[lock.Version](lock); err != nil {
+			return fmt.Errorf(
+				"migrating proto.lock from version %d: %w", lock.Version, err,
+			)
+		}
+		lock.Version++
+	}
+
+	return nil
+}
+
+// Migrate will return an io.Reader with the contents of the proto.lock file
+// rewritten in the current format, see LockVersion. The proto files are not
+// parsed, so the locked definitions are unchanged. ErrLockNotFound is returned
+// if there is no proto.lock file.
+func Migrate(cfg Config) (io.Reader, error) {
+	lock, err := ReadLock(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return readerFromProtolock(&lock)
+}
@@ -0,0 +1,60 @@
+package protolock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const unversionedLock = `{
+  "definitions": [
+    {
+      "protopath": "test.proto",
+      "def": {
+        "messages": [{ "name": "Test" }]
+      }
+    }
+  ]
+}`
+
+func TestFromReaderVersion(t *testing.T) {
+	lock, err := FromReader(strings.NewReader(unversionedLock))
+	assert.NoError(t, err)
+	assert.Equal(t, LockVersion, lock.Version)
+	assert.Len(t, lock.Definitions, 1)
+
+	_, err = FromReader(strings.NewReader(`{"version": 1000}`))
+	assert.True(t, errors.Is(err, ErrUnsupportedLockVersion))
+
+	// a negative version is not written by any version of protolock
+	_, err = FromReader(strings.NewReader(`{"version": -1}`))
+	assert.True(t, errors.Is(err, ErrMalformedLock))
+	assert.False(t, errors.Is(err, ErrUnsupportedLockVersion))
+	assert.NotContains(t, err.Error(), "upgrade protolock")
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := NewConfig(dir, dir, ignoreArg, false, false)
+	assert.NoError(t, err)
+
+	_, err = Migrate(*cfg)
+	assert.Equal(t, ErrLockNotFound, err)
+
+	err = os.WriteFile(
+		filepath.Join(dir, LockFileName), []byte(unversionedLock), 0644,
+	)
+	assert.NoError(t, err)
+
+	r, err := Migrate(*cfg)
+	assert.NoError(t, err)
+
+	lock, err := FromReader(r)
+	assert.NoError(t, err)
+	assert.Equal(t, LockVersion, lock.Version)
+	assert.Equal(t, Protopath("test.proto"), lock.Definitions[0].Filepath)
+}